@@ -1,11 +1,10 @@
 # This file is loaded when VM is done bootstraping
 
-# TODO make those path absolute
-load "lib/primitives.rb"
-load "lib/object.rb"
-load "lib/class.rb"
-load "lib/enumerable.rb"
-load "lib/array.rb"
-load "lib/fixnum.rb"
-load "lib/string.rb"
-load "lib/range.rb"
+require_relative "primitives"
+require_relative "object"
+require_relative "class"
+require_relative "enumerable"
+require_relative "array"
+require_relative "fixnum"
+require_relative "string"
+require_relative "range"
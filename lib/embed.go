@@ -0,0 +1,8 @@
+// Package lib holds the part of the core library written in Ruby. The files are embedded in the
+// tinyrb binary, which boots from them unless TINYRB_LIB points to a directory.
+package lib
+
+import "embed";
+
+//go:embed *.rb
+var Files embed.FS;
@@ -6,4 +6,8 @@ class Object
   def ==(other)
     object_id == other.object_id
   end
-end
\ No newline at end of file
+  
+  def ===(other)
+    self == other
+  end
+end
@@ -4,4 +4,15 @@ class Range
   def to_s
     first.to_s + ".." + last.to_s
   end
+  
+  def ===(value)
+    return false unless first <= value
+    if exclude_end?
+      last > value
+    else
+      last >= value
+    end
+  rescue ArgumentError, NoMethodError
+    false
+  end
 end
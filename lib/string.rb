@@ -6,4 +6,8 @@ class String
   def inspect
     '"' + self + '"'
   end
+  
+  def ==(other)
+    (self <=> other) == 0
+  end
 end
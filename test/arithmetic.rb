@@ -0,0 +1,69 @@
+puts 6 * 7
+# => 42
+puts 7 / 2
+# => 3
+n = 0 - 7
+puts n / 2
+# => -4
+puts 7 % 3
+# => 1
+puts n % 3
+# => 2
+puts 3 == 3
+# => true
+puts 2 <= 3
+# => true
+puts 2 > 3
+# => false
+puts 3 >= 3
+# => true
+
+# overflow into Bignum and back
+big = 4611686018427387903 + 1
+puts big
+# => 4611686018427387904
+puts big.class
+# => Bignum
+puts big * big
+# => 21267647932558653966460912964485513216
+small = big - 1
+puts small.class
+# => Fixnum
+puts big > 1
+# => true
+puts 1 < big
+# => true
+
+# literals too big for a Fixnum are Bignums
+literal = 4611686018427387904
+puts literal.class
+# => Bignum
+puts literal == big
+# => true
+puts 21267647932558653966460912964485513216 / big
+# => 4611686018427387904
+puts 4611686018427387903.class
+# => Fixnum
+
+begin
+  1 / 0
+rescue ZeroDivisionError => e
+  puts e.message
+end
+# => divided by 0
+
+begin
+  1 + "one"
+rescue TypeError => e
+  puts e.message
+end
+# => String can't be coerced into Fixnum
+
+# redefined operators are sent
+class Fixnum
+  def +(other)
+    "plus"
+  end
+end
+puts 1 + 2
+# => plus
@@ -0,0 +1,69 @@
+def risky
+  raise ArgumentError, "bad"
+end
+
+begin
+  risky
+  puts "not here"
+rescue TypeError
+  puts "wrong rescue"
+rescue ArgumentError => e
+  puts e.message
+else
+  puts "no else"
+ensure
+  puts "ensured"
+end
+
+x = begin
+  1
+rescue
+  2
+else
+  3
+end
+puts x
+
+def with_ensure
+  return "returned"
+ensure
+  puts "cleanup"
+end
+puts with_ensure
+
+def with_rescue
+  raise "oops"
+rescue => e
+  "rescued " + e.message
+end
+puts with_rescue
+
+begin
+  begin
+    raise "inner"
+  ensure
+    puts "inner ensure"
+  end
+rescue RuntimeError
+  puts $!
+end
+
+# an empty ensure still rethrows
+begin
+  begin
+    raise "empty ensure"
+  ensure
+  end
+rescue RuntimeError
+  puts $!
+end
+
+# => bad
+# => ensured
+# => 3
+# => cleanup
+# => returned
+# => rescued oops
+# => inner ensure
+# => inner
+# => empty ensure
@@ -0,0 +1,109 @@
+i = 0
+found = while i < 10
+  break i * 2 if i == 3
+  i += 1
+end
+puts found
+# => 6
+
+j = 0
+none = until j == 2
+  j += 1
+end
+puts none == nil
+# => true
+
+# next goes back to the condition
+k = 0
+odd = 0
+while k < 5
+  k += 1
+  next if (k % 2) == 0
+  odd += 1
+end
+puts odd
+# => 3
+
+def each_twice
+  yield 1
+  yield 2
+  puts "not reached"
+end
+
+def first_found
+  each_twice do |n|
+    break n * 10
+  end
+end
+puts first_found
+# => 10
+
+# next returns its value to yield
+def collect
+  results = []
+  results << yield(1)
+  results << yield(2)
+  results
+end
+
+values = collect do |n|
+  next "skip" if n == 1
+  "keep"
+end
+puts values.join(",")
+# => skip,keep
+
+# break out of an inner loop only
+outer = 0
+while outer < 2
+  outer += 1
+  inner = 0
+  while true
+    inner += 1
+    break if inner == 3
+  end
+end
+puts outer
+puts inner
+# => 2
+# => 3
+
+# ensure of the yielding method runs on break
+def guarded
+  yield
+ensure
+  puts "ensure"
+end
+guarded do
+  break
+end
+# => ensure
+
+def make_proc
+  proc do
+    break
+  end
+end
+
+begin
+  make_proc.call
+rescue LocalJumpError => e
+  puts e.message
+end
+# => break from proc-closure
+
+l = lambda do
+  break "from lambda"
+end
+puts l.call
+# => from lambda
+
+# the value of a loop doesn't land in a local of its body
+last = while true
+  seen = 1
+  break 2
+end
+puts seen
+puts last
+# => 1
+# => 2
@@ -0,0 +1,18 @@
+# an invalid .trc next to a source file is ignored
+require_relative "fixtures/stale"
+# => stale.rb compiled from source
+
+# and refused when loaded directly
+begin
+  load "test/fixtures/corrupt.trc"
+rescue LoadError => e
+  puts e.message
+end
+# => test/fixtures/corrupt.trc: not a tinyrb bytecode file
+
+begin
+  load "test/fixtures/stale.trc"
+rescue LoadError => e
+  puts e.message
+end
+# => test/fixtures/stale.trc: not a tinyrb bytecode file
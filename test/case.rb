@@ -0,0 +1,81 @@
+def kind(value)
+  case value
+  when 0
+    "zero"
+  when 1, 2, 3 then "small"
+  when 4..9
+    "medium"
+  when String, Symbol
+    "text"
+  else
+    "other"
+  end
+end
+
+puts kind(0)
+# => zero
+puts kind(2)
+# => small
+puts kind(7)
+# => medium
+puts kind(10)
+# => other
+puts kind("ten")
+# => text
+puts kind(:ten)
+# => text
+
+def word(value)
+  case value
+  when /^a/
+    "starts with a"
+  when "bee"
+    "bee"
+  end
+end
+
+puts word("apple")
+# => starts with a
+puts word("bee")
+# => bee
+puts word("cat") == nil
+# => true
+
+# w/o a subject the first true condition wins
+x = 5
+size = case
+       when x < 3 then "low"
+       when x < 8 then "mid"
+       else
+         "high"
+       end
+puts size
+# => mid
+
+puts Fixnum === 3
+# => true
+puts Fixnum === "3"
+# => false
+exclusive = 1...3
+puts exclusive === 3
+# => false
+inclusive = 1..3
+puts inclusive === 3
+# => true
+puts inclusive === "a"
+# => false
+pattern = /b/
+puts pattern === "abc"
+# => true
+
+class Even
+  def self.===(n)
+    (n % 2) == 0
+  end
+end
+
+case 4
+when Even
+  puts "even"
+end
+# => even
@@ -0,0 +1,65 @@
+module Outer
+  VALUE = "outer"
+
+  class Inner
+    def value
+      VALUE
+    end
+  end
+
+  module Deep
+    VALUE = "deep"
+
+    def self.value
+      VALUE
+    end
+  end
+end
+
+puts Outer::Inner.new.value
+# => outer
+puts Outer::Deep.value
+# => deep
+puts Outer::Inner.name
+# => Outer::Inner
+puts ::Outer::VALUE
+# => outer
+
+puts Outer.const_get(:VALUE)
+# => outer
+puts Outer.const_defined?(:VALUE)
+# => true
+puts Outer.const_defined?(:NOPE)
+# => false
+Outer.const_set(:OTHER, "set")
+puts Outer::OTHER
+# => set
+
+class Base
+  LIMIT = 10
+end
+
+class Child < Base
+  def limit
+    LIMIT
+  end
+end
+
+puts Child.new.limit
+# => 10
+
+class Lazy
+  def self.const_missing(name)
+    "missing " + name.to_s
+  end
+end
+
+puts Lazy::Anything
+# => missing Anything
+
+begin
+  Nope
+rescue NameError => e
+  puts e.message
+end
+# => uninitialized constant Nope
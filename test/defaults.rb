@@ -15,4 +15,34 @@ a 3, 4
 a 3, 4, 5
 # => 3
 # => 4
-# => 5
\ No newline at end of file
+# => 5
+
+# defaults followed by a splat
+def b(x, y=1, *rest)
+  puts x, y, rest.size
+end
+
+b 0
+# => 0
+# => 1
+# => 0
+
+b 0, 2
+# => 0
+# => 2
+# => 0
+
+b 0, 2, 3, 4
+# => 0
+# => 2
+# => 2
+
+puts method(:b).arity
+# => -2
+
+begin
+  b
+rescue ArgumentError => e
+  puts e.message
+end
+# => wrong number of arguments (0 for 1+)
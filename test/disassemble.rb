@@ -0,0 +1,37 @@
+def answer
+  42
+end
+
+listing = method(:answer).disassemble
+puts /R\[0\] = 42/.match(listing).to_a.inspect
+# => ["R[0] = 42"]
+puts /line 2/.match(listing).to_a.inspect
+# => ["line 2"]
+puts /return R\[0\]/.match(listing).to_a.inspect
+# => ["return R[0]"]
+
+if /"opcode": "loadk"/.match(method(:answer).disassemble(:json))
+  puts "json"
+end
+# => json
+
+# native methods have no bytecode
+puts method(:puts).disassemble
+# => 
+
+puts /R\[0\] = 42/.match(method(:answer).disassemble(:text)).to_a.inspect
+# => ["R[0] = 42"]
+
+begin
+  method(:answer).disassemble(:yaml)
+rescue ArgumentError => e
+  puts e.message
+end
+# => unknown format :yaml, expected :text or :json
+
+begin
+  method(:answer).disassemble(:text, :json)
+rescue ArgumentError => e
+  puts e.message
+end
+# => wrong number of arguments (2 for 0..1)
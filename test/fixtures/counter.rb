@@ -0,0 +1,7 @@
+$counter_loads = ($counter_loads || 0) + 1
+
+class Counter
+  def self.loads
+    $counter_loads
+  end
+end
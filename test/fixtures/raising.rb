@@ -0,0 +1,3 @@
+require_relative "raising_dep"
+$raising_runs = ($raising_runs || 0) + 1
+raise "raising"
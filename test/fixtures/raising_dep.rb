@@ -0,0 +1 @@
+$raising_dep_runs = ($raising_dep_runs || 0) + 1
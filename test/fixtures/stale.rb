@@ -0,0 +1 @@
+puts "stale.rb compiled from source"
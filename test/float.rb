@@ -0,0 +1,78 @@
+puts 1.5
+# => 1.5
+puts 100.0
+# => 100.0
+puts 2.5e3
+# => 2500.0
+puts 1e20
+# => 1.0e+20
+puts 1.5.class
+# => Float
+
+puts 1 + 0.5
+# => 1.5
+puts 0.5 + 1
+# => 1.5
+puts 3 / 2.0
+# => 1.5
+puts 2 * 1.25
+# => 2.5
+puts 1 < 1.5
+# => true
+puts 2.0 == 2
+# => true
+puts 7.5 % 2
+# => 1.5
+
+puts 3.7.to_i
+# => 3
+puts 3.to_f
+# => 3.0
+puts 2.5.round
+# => 3
+puts 2.4.round
+# => 2
+puts 2.7.floor
+# => 2
+puts 2.1.ceil
+# => 3
+
+# 2**62 is one past the largest Fixnum
+big = 4611686018427387904.0
+puts big.to_i
+# => 4611686018427387904
+puts big.to_i.class
+# => Bignum
+smallest = 0 - big
+puts smallest.to_i.class
+# => Fixnum
+
+puts Float::INFINITY
+# => Infinity
+puts 1.0 / 0
+# => Infinity
+puts Float::NAN.nan?
+# => true
+
+# user classes join arithmetic through coerce
+class Meters
+  def initialize(n)
+    @n = n
+  end
+
+  def coerce(other)
+    [other, @n]
+  end
+end
+
+puts 10 + Meters.new(5)
+# => 15
+puts 1.5 * Meters.new(2)
+# => 3.0
+
+begin
+  1.5 + "x"
+rescue TypeError => e
+  puts e.message
+end
+# => String can't be coerced into Float
@@ -0,0 +1,47 @@
+name = "world"
+puts "hello #{name}"
+# => hello world
+
+x = 2
+puts "#{x} + #{x} = #{x + x}"
+# => 2 + 2 = 4
+
+puts "nil:#{nil}, sym:#{:a}, float:#{1.5}"
+# => nil:, sym:a, float:1.5
+
+puts "nested #{"in #{name}"}"
+# => nested in world
+
+puts "#{}empty"
+# => empty
+
+puts "no \#{interpolation} # here"
+# => no #{interpolation} # here
+
+class Point
+  def initialize(x, y)
+    @x = x
+    @y = y
+  end
+
+  def to_s
+    "(#{@x}, #{@y})"
+  end
+end
+
+puts "point #{Point.new(1, 2)}"
+# => point (1, 2)
+
+prefix = "ab"
+pattern = /^#{prefix}c/
+puts pattern.match("abcd")
+# => abc
+puts pattern.match("xabc") == nil
+# => true
+
+begin
+  eval('"a#{x = 1}b"')
+rescue SyntaxError => e
+  puts e.message
+end
+# => Can't create local variable inside String
@@ -0,0 +1,16 @@
+def check(value)
+  if value
+    raise ArgumentError, "bad"
+  end
+end
+
+# the call is on the line it starts, not the one of the statement following it
+begin
+  check true
+  puts "not here"
+rescue ArgumentError => e
+  puts e.backtrace[0]
+  puts e.backtrace[1]
+end
+# => test/line_table.rb:3:in `check'
+# => test/line_table.rb:9
@@ -0,0 +1,65 @@
+def sum(*values)
+  total = 0
+  values.each do |v|
+    total = total + v
+  end
+  total
+end
+
+numbers = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15]
+puts sum(*numbers)
+# => 120
+
+def twelve(a, b, c, d, e, f, g, h, i, j, k, l)
+  l
+end
+puts twelve(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+# => 12
+
+def two(a, b)
+  a
+end
+begin
+  two 1
+rescue ArgumentError => e
+  puts e.message
+end
+# => wrong number of arguments (1 for 2)
+
+def opt(a, b = 2)
+  a
+end
+begin
+  opt 1, 2, 3
+rescue ArgumentError => e
+  puts e.message
+end
+# => wrong number of arguments (3 for 1..2)
+puts method(:opt).arity
+# => -2
+
+begin
+  1.to_s 2, 3
+rescue ArgumentError => e
+  puts e.message
+end
+# => wrong number of arguments (2 for 0)
+
+# more args than CALL can count is a syntax error, not a truncated call
+def ones(count)
+  args = "1"
+  n = 1
+  while n < count
+    args = args + ", 1"
+    n += 1
+  end
+  args
+end
+begin
+  eval("sum(" + ones(128) + ")")
+rescue SyntaxError => e
+  puts e.message
+end
+# => Too many arguments (128), at most 127 can be passed
+puts eval("sum(" + ones(127) + ")")
+# => 127
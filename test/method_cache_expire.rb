@@ -0,0 +1,145 @@
+class Dog
+  def speak
+    "woof"
+  end
+
+  def growl
+    "grr"
+  end
+
+  def self.label
+    "dog"
+  end
+end
+
+class Puppy < Dog
+end
+
+module Quiet
+  def speak
+    "..."
+  end
+end
+
+def talk(animal)
+  puts animal.speak
+end
+
+def label(klass)
+  puts klass.label
+end
+
+dog = Dog.new
+talk dog
+# => woof
+
+# redefining the method expires the cached lookup
+class Dog
+  def speak
+    "WOOF"
+  end
+end
+talk dog
+# => WOOF
+
+class Dog
+  alias_method :speak, :growl
+end
+talk dog
+# => grr
+
+puppy = Puppy.new
+talk puppy
+# => grr
+
+class Puppy
+  include Quiet
+end
+talk puppy
+# => ...
+
+label Dog
+# => dog
+
+class Dog
+  def self.label
+    "hound"
+  end
+end
+label Dog
+# => hound
+
+# a site missing over and over is cached again for the new class
+[1, 2, 3].each do |i|
+  talk dog
+end
+[1, 2, 3].each do |i|
+  talk puppy
+end
+# => grr
+# => grr
+# => grr
+# => ...
+# => ...
+# => ...
+
+# a method added to an included module expires the classes including it
+module Loud
+end
+
+class Cat
+  include Loud
+end
+
+def shout(animal)
+  puts animal.shout
+end
+
+class Cat
+  def method_missing(name)
+    "no #{name}"
+  end
+end
+cat = Cat.new
+shout cat
+# => no shout
+
+module Loud
+  def shout
+    "MEOW"
+  end
+end
+shout cat
+# => MEOW
+
+# an alias is a copy, the original keeps its name for super
+class Animal
+  def name
+    "animal"
+  end
+end
+
+class Bird < Animal
+  def name
+    "bird < " + super
+  end
+  alias_method :title, :name
+
+  def sound
+    "tweet"
+  end
+  alias_method :chirp, :sound
+end
+puts Bird.new.name
+# => bird < animal
+puts Bird.new.chirp
+# => tweet
+
+begin
+  class Bird
+    alias_method :fly, :soar
+  end
+rescue NameError => e
+  puts e.message
+end
+# => undefined method `soar' for class `Bird'
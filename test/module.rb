@@ -18,3 +18,34 @@ y.yeah
 
 y.nice
 # => you're hot
+
+# included modules are ancestors for ===, when and rescue
+module Other
+end
+
+puts Awesome === y
+# => true
+puts Other === y
+# => false
+
+case y
+when Other
+  puts "other"
+when Awesome
+  puts "awesome"
+end
+# => awesome
+
+module Retryable
+end
+
+class FlakyError < StandardError
+  include Retryable
+end
+
+begin
+  raise FlakyError, "flaky"
+rescue Retryable => e
+  puts "retry " + e.message
+end
+# => retry flaky
@@ -0,0 +1,97 @@
+a, b = 1, 2
+puts a
+puts b
+# => 1
+# => 2
+
+a, b = b, a
+puts a
+puts b
+# => 2
+# => 1
+
+x, y, z = 1, 2
+puts z == nil
+# => true
+
+first, *rest = 1, 2, 3
+puts first
+puts rest.size
+# => 1
+# => 2
+
+*init, last = [1, 2, 3]
+puts init.size
+puts last
+# => 2
+# => 3
+
+head, *middle, tail = [1]
+puts head
+puts middle.size
+puts tail == nil
+# => 1
+# => 0
+# => true
+
+(p1, p2), p3 = [1, 2], 3
+puts p1 + p2 + p3
+# => 6
+
+@i, $g = "ivar", "global"
+puts @i
+puts $g
+# => ivar
+# => global
+
+def pair
+  return "left", "right"
+end
+
+l, r = pair
+puts l
+puts r
+# => left
+# => right
+
+class Pair
+  def to_ary
+    ["to", "ary"]
+  end
+end
+
+m, n = Pair.new
+puts m
+puts n
+# => to
+# => ary
+
+# a value that can't be converted goes to the first target
+o, q = 5
+puts o
+puts q == nil
+# => 5
+# => true
+
+[["a", 1], ["b", 2]].each_with_index do |(name, value), i|
+  puts name
+  puts value + i
+end
+# => a
+# => 1
+# => b
+# => 3
+
+sum = 0
+[[1, [2, 3]]].each do |(one, (two, three))|
+  sum = one + two + three
+end
+puts sum
+# => 6
+
+begin
+  eval("a, b = 1, (c = 2)")
+rescue SyntaxError => e
+  puts e.message
+end
+# => Can't create local variable inside multiple assignment
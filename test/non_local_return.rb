@@ -16,3 +16,39 @@ puts "end"
 # => ok
 # => 1
 # => end
+
+# return leaves the method the block is in, not the one calling it
+def caller_with_block
+  yielder { return "from block" }
+  "not here"
+end
+
+def calls_with_a_block
+  caller_with_block { "unused" } + " in caller"
+end
+puts calls_with_a_block
+# => from block in caller
+
+# a proc returning from a method that is over can't
+def make_proc
+  proc { return 1 }
+end
+
+def run(p)
+  p.call
+  "run went on"
+end
+
+begin
+  run(make_proc)
+rescue LocalJumpError => e
+  puts e.message
+end
+# => unexpected return
+
+# a lambda returns from itself
+def make_lambda
+  lambda { return 2 }
+end
+puts make_lambda.call
+# => 2
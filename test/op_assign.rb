@@ -0,0 +1,111 @@
+a = 1
+a += 2
+puts a
+# => 3
+a -= 1
+a *= 10
+a /= 4
+a %= 3
+puts a
+# => 2
+
+s = "ab"
+s <<= "c"
+puts s
+# => abc
+
+b ||= "set"
+puts b
+# => set
+b ||= "not set"
+puts b
+# => set
+b &&= "replaced"
+puts b
+# => replaced
+c = nil
+c &&= "never"
+puts c == nil
+# => true
+
+# upvals
+total = 0
+[1, 2, 3].each do |i|
+  total += i
+end
+puts total
+# => 6
+
+class Counter
+  def count
+    @count
+  end
+
+  def count=(value)
+    @count = value
+  end
+
+  def initialize
+    @count = 0
+    @@made ||= 0
+    @@made += 1
+  end
+
+  def bump
+    @count += 1
+    @cache ||= "cached"
+  end
+
+  def self.made
+    @@made
+  end
+end
+
+counter = Counter.new
+counter.bump
+counter.bump
+puts counter.count
+# => 2
+counter.count += 5
+puts counter.count
+# => 7
+Counter.new
+puts Counter.made
+# => 2
+
+$hits ||= 10
+$hits += 1
+puts $hits
+# => 11
+
+# the receiver and index are evaluated only once
+def list
+  puts "list"
+  @list ||= [1, 2]
+end
+list[0] += 10
+# => list
+puts list[0]
+# => list
+# => 11
+
+h = {}
+h["k"] ||= "first"
+h["k"] ||= "second"
+puts h["k"]
+# => first
+
+# the setter isn't called when ||= short-circuits
+class Box
+  def value
+    "kept"
+  end
+
+  def value=(v)
+    puts "setter called"
+  end
+end
+box = Box.new
+box.value ||= "new"
+puts box.value
+# => kept
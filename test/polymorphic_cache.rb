@@ -0,0 +1,54 @@
+class Circle
+  def name
+    "circle"
+  end
+end
+
+class Square
+  def name
+    "square"
+  end
+end
+
+class Triangle
+  def name
+    "triangle"
+  end
+end
+
+class Hexagon
+  def name
+    "hexagon"
+  end
+end
+
+class Star
+  def name
+    "star"
+  end
+end
+
+# the same call site sees more classes than it caches
+[Circle.new, Square.new, Triangle.new, Hexagon.new, Star.new, Circle.new, Star.new].each do |shape|
+  puts shape.name
+end
+# => circle
+# => square
+# => triangle
+# => hexagon
+# => star
+# => circle
+# => star
+
+# redefining a method also expires megamorphic lookups
+class Star
+  def name
+    "sparkle"
+  end
+end
+
+[Circle.new, Star.new].each do |shape|
+  puts shape.name
+end
+# => circle
+# => sparkle
@@ -0,0 +1,69 @@
+def counter
+  count = 0
+  lambda do
+    count = count + 1
+  end
+end
+
+c = counter
+c.call
+puts c.call
+# => 2
+
+add = proc do |a, b|
+  a + b
+end
+puts add[1, 2]
+puts add.arity
+puts add.lambda?
+# => 3
+# => 2
+# => false
+
+l = lambda do |x|
+  return x + 1
+  puts "not here"
+end
+puts l.call(1)
+puts l.lambda?
+# => 2
+# => true
+
+def block_to_proc(&blk)
+  blk
+end
+p = block_to_proc do |x|
+  x
+end
+puts p.call(4)
+# => 4
+
+def twice
+  yield
+  yield
+end
+hi = lambda do
+  puts "hi"
+end
+twice(&hi)
+# => hi
+# => hi
+
+def no_block(&blk)
+  blk
+end
+puts "no block" unless no_block
+# => no block
+
+rest = lambda do |a, *r|
+  r
+end
+puts rest.call(1, 2, 3).size
+# => 2
+
+begin
+  rest.call
+rescue ArgumentError => e
+  puts e.message
+end
+# => wrong number of arguments (0 for 1+)
@@ -12,4 +12,4 @@ puts "oh no boy, ur not coming here!"
 # => RuntimeError: ouch!
 # => 	from test/raise.rb:2:in `guacamole'
 # => 	from test/raise.rb:6:in `deep_in'
-# => 	from test/raise.rb:10
+# => 	from test/raise.rb:9
@@ -0,0 +1,48 @@
+puts __FILE__
+# => test/require.rb
+
+puts require_relative("fixtures/counter")
+# => true
+puts require_relative("fixtures/counter.rb")
+# => false
+puts Counter.loads
+# => 1
+
+# the extension and the load path are optional
+$LOAD_PATH << __dir__ + "/fixtures"
+puts require("counter")
+# => false
+puts require("pony")
+# => true
+puts Pony.new.eat!
+# => nom nom
+
+# load runs the file each time
+load "test/fixtures/counter.rb"
+puts Counter.loads
+# => 2
+
+begin
+  require "nothing_here"
+rescue LoadError => e
+  puts e.message
+end
+# => cannot load such file -- nothing_here
+
+# a file that raises can be required again, not the files it required
+begin
+  require_relative "fixtures/raising"
+rescue RuntimeError => e
+  puts e.message
+end
+begin
+  require_relative "fixtures/raising"
+rescue RuntimeError => e
+  puts e.message
+end
+# => raising
+# => raising
+puts $raising_runs
+# => 2
+puts $raising_dep_runs
+# => 1
@@ -19,7 +19,7 @@ ensure
 end
 
 # => ouch!
-# => test/raise.rb:2:in `guacamole'
-# => test/raise.rb:6:in `deep_in'
-# => test/raise.rb:10
+# => test/rescue.rb:2:in `guacamole'
+# => test/rescue.rb:6:in `deep_in'
+# => test/rescue.rb:10
 # => ensured
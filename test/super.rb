@@ -0,0 +1,56 @@
+class Animal
+  def speak(sound)
+    "..." + sound
+  end
+  
+  def name
+    "animal"
+  end
+  
+  def each_sound
+    yield "grr"
+  end
+  
+  def self.create
+    "created"
+  end
+end
+
+module Loud
+  def speak(sound)
+    super(sound + "!")
+  end
+end
+
+class Dog < Animal
+  include Loud
+  
+  def speak(sound)
+    super
+  end
+  
+  def name
+    "dog < " + super()
+  end
+  
+  def each_sound
+    super
+  end
+  
+  def self.create
+    "dog " + super
+  end
+end
+
+d = Dog.new
+puts d.speak("woof")
+puts d.name
+d.each_sound do |s|
+  puts s
+end
+puts Dog.create
+
+# => ...woof!
+# => dog < animal
+# => grr
+# => dog created
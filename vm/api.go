@@ -0,0 +1,299 @@
+import (
+	"fmt";
+	"io";
+	"math/big";
+	"reflect";
+	"strings";
+	"tr";
+)
+
+// The API for Go programs embedding tinyrb. A RubyVM isn't safe for use by several goroutines at
+// once, but VMs are independent of each other.
+
+// Options of New, the zero value is the one of the tinyrb command.
+type Options struct {
+	LoadPath		[]string;		// directories searched by require before the core library, like -I
+	Stdout			io.Writer;		// where puts prints, os.Stdout if nil
+	Debug			int;			// like -d
+}
+
+// A Ruby object of a VM.
+type Value struct {
+	vm				*RubyVM;
+	obj				RubyObject;
+}
+
+// An exception raised by Ruby code and not rescued.
+type RubyError struct {
+	Exception		Value;
+	Class			string;
+	Message			string;
+	Backtrace		[]string;
+	Err				error;			// the error returned by a Go func that raised the exception, if any
+}
+
+func (e *RubyError) Error() string {
+	return e.Class + ": " + e.Message;
+}
+
+func (e *RubyError) Unwrap() error {
+	return e.Err;
+}
+
+// Returns a VM with the core library loaded. opts can be nil.
+func New(opts *Options) (*RubyVM, error) {
+	if opts == nil { opts = &Options{}; }
+	vm := alloc_vm();
+	if opts.Stdout != nil { vm.out = opts.Stdout; }
+	vm.debug = opts.Debug;
+	if vm.boot() == TR_UNDEF { return nil, vm.take_error(); }
+	load_path := Array *(vm.globals[TrSymbol_new(vm, "$LOAD_PATH")]);
+	for n, dir := range opts.LoadPath { load_path.values.Insert(n, TrString_new2(vm, absolute_path(dir))); }
+	return vm, nil;
+}
+
+// Returns the exception thrown in vm as an error, and clears it so the VM can go on.
+func (vm *RubyVM) take_error() error {
+	if vm.throw_reason != TR_THROW_EXCEPTION {
+		// break or return out of the top level, which rescue can't catch either
+		vm.throw_value = TrException_new(vm, vm.cLocalJumpError, tr_sprintf(vm, "unexpected break or return"));
+	}
+	exception := vm.wrap(vm.throw_value);
+	vm.throw_reason = vm.throw_value = 0;
+
+	e := &RubyError{Exception: exception, Class: Class *(Object_class(vm, exception.obj)).name.ptr, Err: vm.go_errors[exception.obj]};
+	delete(vm.go_errors, exception.obj);
+	if msg := TrException_message(vm, exception.obj, nil, nil); msg != TR_NIL { e.Message = msg.ptr; }
+	if backtrace := TrException_backtrace(vm, exception.obj, nil, nil); backtrace != TR_NIL {
+		for item := range Array *(backtrace).values.Iter() { e.Backtrace = append(e.Backtrace, item.ptr); }
+	}
+	return e;
+}
+
+func (vm *RubyVM) wrap(obj RubyObject) Value {
+	return Value{vm: vm, obj: obj};
+}
+
+// Returns obj as a Value, or the error it was thrown instead.
+func (vm *RubyVM) result(obj RubyObject) (Value, error) {
+	if obj == TR_UNDEF { return Value{}, vm.take_error(); }
+	return vm.wrap(obj), nil;
+}
+
+// Runs src at the top level, filename is the one of backtraces and __FILE__.
+func (vm *RubyVM) Eval(src, filename string) (Value, error) {
+	return vm.result(vm.eval(src, filename));
+}
+
+// Runs a file at the top level, like Kernel#load.
+func (vm *RubyVM) LoadFile(filename string) (Value, error) {
+	return vm.result(vm.load(filename));
+}
+
+// Sends method to recv, which like args can be a Value or a Go value ValueOf converts.
+func (vm *RubyVM) Call(recv interface{}, method string, args ...interface{}) (Value, error) {
+	argv := make([]RubyObject, len(args) + 2);
+	argv[1] = TrSymbol_new(vm, method);
+	for n, x := range append([]interface{}{ recv }, args...) {
+		v, err := vm.ValueOf(x);
+		if err != nil { return Value{}, err; }
+		if n == 0 { argv[0] = v.obj; } else { argv[n + 1] = v.obj; }
+	}
+	return vm.result(Object_send(vm, argv[0], len(args) + 1, argv[1:]));
+}
+
+// Returns the top level object, self of the code Eval runs.
+func (vm *RubyVM) Main() Value {
+	return vm.wrap(vm.self);
+}
+
+func global_name(name string) string {
+	if strings.HasPrefix(name, "$") { return name; }
+	return "$" + name;
+}
+
+// Returns the value of a global variable, nil if it isn't set. The $ can be left out of name.
+func (vm *RubyVM) Global(name string) Value {
+	return vm.wrap(vm.globals[TrSymbol_new(vm, global_name(name))] || TR_NIL);
+}
+
+func (vm *RubyVM) SetGlobal(name string, value interface{}) error {
+	v, err := vm.ValueOf(value);
+	if err != nil { return err; }
+	vm.globals[TrSymbol_new(vm, global_name(name))] = v.obj;
+	return nil;
+}
+
+// Returns a constant of the top level, or nested in modules like "Foo::Bar" or "::Foo::Bar".
+func (vm *RubyVM) Const(name string) (Value, error) {
+	obj := TR_NIL;
+	for n, part := range strings.Split(strings.TrimPrefix(name, "::"), "::") {
+		if n == 0 {
+			obj = Object_const_get(vm, nil, TrSymbol_new(vm, part));
+		} else if TR_IMMEDIATE(obj) || (!obj.(Class) && !obj.(Module)) {
+			obj = vm.raise(vm.cTypeError, "%s is not a class/module", vm.wrap(obj).Inspect());
+		} else {
+			obj = Module *(obj).const_get(vm, TrSymbol_new(vm, part));
+		}
+		if obj == TR_UNDEF { return vm.result(obj); }
+	}
+	return vm.wrap(obj), nil;
+}
+
+// Returns x as a Ruby object: a Value as it is, nil, booleans, numbers and strings as their Ruby
+// counterpart, []byte as a String, other slices and arrays as Arrays and maps as Hashes, converting
+// their elements, and pointers of a type given to DefineStruct as objects of its class.
+func (vm *RubyVM) ValueOf(x interface{}) (Value, error) {
+	switch x := x.(type) {
+		case nil: return vm.wrap(TR_NIL), nil;
+		case Value:
+			if x.vm != vm && x.vm != nil { return Value{}, fmt.Errorf("tinyrb: value of another VM"); }
+			if x.vm == nil { return vm.wrap(TR_NIL), nil; }
+			return x, nil;
+		case *big.Int: return vm.wrap(TrBignum_normalize(vm, new(big.Int).Set(x))), nil;
+		case []byte: return vm.wrap(TrString_new(vm, string(x), len(x))), nil;
+	}
+	v := reflect.ValueOf(x);
+	if class, ok := vm.go_types[v.Type()]; ok {
+		if v.IsNil() { return vm.wrap(TR_NIL), nil; }
+		return vm.wrap(GoObject{type: TR_T_Object, class: class, ivars: make(map[string] RubyObject), value: v}), nil;
+	}
+	switch v.Kind() {
+		case reflect.Bool:
+			return vm.wrap(TR_BOOL(v.Bool())), nil;
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return vm.wrap(TrBignum_normalize(vm, big.NewInt(v.Int()))), nil;
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return vm.wrap(TrBignum_normalize(vm, new(big.Int).SetUint64(v.Uint()))), nil;
+		case reflect.Float32, reflect.Float64:
+			return vm.wrap(TrFloat_new(vm, v.Float())), nil;
+		case reflect.String:
+			return vm.wrap(TrString_new2(vm, v.String())), nil;
+		case reflect.Slice, reflect.Array:
+			a := vm.newArray();
+			for n := 0; n < v.Len(); n++ {
+				item, err := vm.ValueOf(v.Index(n).Interface());
+				if err != nil { return Value{}, err; }
+				a.Push(item.obj);
+			}
+			return vm.wrap(a), nil;
+		case reflect.Map:
+			h := TrHash_new(vm);
+			for _, key := range v.MapKeys() {
+				k, err := vm.ValueOf(key.Interface());
+				if err != nil { return Value{}, err; }
+				value, err := vm.ValueOf(v.MapIndex(key).Interface());
+				if err != nil { return Value{}, err; }
+				TrHash_set(vm, h, { k.obj, value.obj }, nil);
+			}
+			return vm.wrap(h), nil;
+	}
+	return Value{}, fmt.Errorf("tinyrb: can't convert %T to a Ruby object", x);
+}
+
+func (v Value) IsNil() bool {
+	return v.vm == nil || v.obj == TR_NIL;
+}
+
+// Returns the name of the class of v.
+func (v Value) Class() string {
+	if v.vm == nil { return "NilClass"; }
+	return Class *(Object_class(v.vm, v.obj)).name.ptr;
+}
+
+// Sends method to v, see RubyVM.Call.
+func (v Value) Call(method string, args ...interface{}) (Value, error) {
+	if v.vm == nil { return Value{}, fmt.Errorf("tinyrb: %s called on a zero Value", method); }
+	return v.vm.Call(v, method, args...);
+}
+
+// Returns the result of to_s, or of inspect if it fails.
+func (v Value) String() string {
+	if v.vm == nil { return ""; }
+	if s, err := v.Call("to_s"); err == nil && s.obj.(String) { return s.obj.ptr; }
+	return v.Inspect();
+}
+
+func (v Value) Inspect() string {
+	if v.vm == nil { return "nil"; }
+	if s, err := v.Call("inspect"); err == nil && s.obj.(String) { return s.obj.ptr; }
+	return fmt.Sprintf("#<%s>", v.Class());
+}
+
+func (v Value) type_error(expected string) error {
+	return fmt.Errorf("tinyrb: expected %s, got %s", expected, v.Class());
+}
+
+// Returns the value of an Integer, an error for a Bignum that doesn't fit an int.
+func (v Value) AsInt() (int, error) {
+	if v.vm == nil { return 0, v.type_error("Integer"); }
+	if TR_IS_FIX(v.obj) { return TR_FIX2INT(v.obj), nil; }
+	if n := TrInteger_to_big(v.obj); n != nil {
+		if !n.IsInt64() || int64(int(n.Int64())) != n.Int64() { return 0, fmt.Errorf("tinyrb: %s doesn't fit an int", n); }
+		return int(n.Int64()), nil;
+	}
+	return 0, v.type_error("Integer");
+}
+
+// Returns the value of a Float or an Integer.
+func (v Value) AsFloat() (float64, error) {
+	if v.vm != nil {
+		if value, ok := TrNumeric_to_float(v.obj); ok { return value, nil; }
+	}
+	return 0, v.type_error("Float");
+}
+
+// Returns the value of a String, or the name of a Symbol.
+func (v Value) AsString() (string, error) {
+	if v.vm != nil && !TR_IMMEDIATE(v.obj) && (v.obj.(String) || v.obj.(Symbol)) { return v.obj.ptr, nil; }
+	return "", v.type_error("String");
+}
+
+// Returns the items of an Array.
+func (v Value) AsSlice() ([]Value, error) {
+	if v.vm == nil || TR_IMMEDIATE(v.obj) || !v.obj.(Array) { return nil, v.type_error("Array"); }
+	items := make([]Value, 0, Array *(v.obj).values.Len());
+	for item := range Array *(v.obj).values.Iter() { items = append(items, v.vm.wrap(item)); }
+	return items, nil;
+}
+
+// Returns the pairs of a Hash.
+func (v Value) AsMap() (map[Value] Value, error) {
+	if v.vm == nil || TR_IMMEDIATE(v.obj) || !v.obj.(Hash) { return nil, v.type_error("Hash"); }
+	pairs := make(map[Value] Value);
+	for key, value := range Hash *(v.obj).hash { pairs[v.vm.wrap(key)] = v.vm.wrap(value); }
+	return pairs, nil;
+}
+
+// Returns v as a Go value: nil, a bool, an int or a *big.Int, a float64, a string for a String or
+// a Symbol, a []interface{} for an Array and a map[interface{}]interface{} for a Hash, with their
+// elements converted too, the pointer an object of DefineStruct wraps, and v itself for any other
+// object.
+func (v Value) Interface() interface{} {
+	if v.IsNil() { return nil; }
+	switch {
+		case v.obj == TR_TRUE: return true;
+		case v.obj == TR_FALSE: return false;
+		case TR_IS_FIX(v.obj): return TR_FIX2INT(v.obj);
+		case v.obj.(Bignum): return new(big.Int).Set(Bignum *(v.obj).value);
+		case v.obj.(Float): return Float *(v.obj).value;
+		case v.obj.(GoObject): return GoObject *(v.obj).value.Interface();
+		case v.obj.(String) || v.obj.(Symbol): return v.obj.ptr;
+		case v.obj.(Array):
+			items, _ := v.AsSlice();
+			values := make([]interface{}, len(items));
+			for n, item := range items { values[n] = item.Interface(); }
+			return values;
+		case v.obj.(Hash):
+			pairs, _ := v.AsMap();
+			values := make(map[interface{}] interface{});
+			for key, value := range pairs {
+				k := key.Interface();
+				// Arrays and Hashes can be keys in Ruby but not in Go
+				if k != nil && !reflect.TypeOf(k).Comparable() { k = key; }
+				values[k] = value.Interface();
+			}
+			return values;
+	}
+	return v;
+}
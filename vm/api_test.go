@@ -0,0 +1,122 @@
+package RubyVM
+
+import (
+	"errors";
+	"math/big";
+	"reflect";
+	"testing";
+)
+
+func newTestVM(t *testing.T) *RubyVM {
+	vm, err := New(nil);
+	if err != nil { t.Fatal(err); }
+	return vm;
+}
+
+func eval(t *testing.T, vm *RubyVM, src string) Value {
+	v, err := vm.Eval(src, "(test)");
+	if err != nil { t.Fatalf("%q: %s", src, err); }
+	return v;
+}
+
+func TestValueOfInterface(t *testing.T) {
+	vm := newTestVM(t);
+	big_value, _ := new(big.Int).SetString("1180591620717411303424", 10);
+	tests := []struct {
+		x, expected interface{};
+		class string;
+	}{
+		{nil, nil, "NilClass"},
+		{true, true, "TrueClass"},
+		{false, false, "FalseClass"},
+		{42, 42, "Fixnum"},
+		{int8(-3), -3, "Fixnum"},
+		{uint64(7), 7, "Fixnum"},
+		{big.NewInt(5), 5, "Fixnum"},
+		{big_value, big_value, "Bignum"},
+		{1.5, 1.5, "Float"},
+		{"tinyrb", "tinyrb", "String"},
+		{[]byte("bytes"), "bytes", "String"},
+		{[]int{1, 2}, []interface{}{1, 2}, "Array"},
+		{[2]string{"a", "b"}, []interface{}{"a", "b"}, "Array"},
+		{map[string]int{"one": 1}, map[interface{}]interface{}{"one": 1}, "Hash"},
+	};
+	for _, test := range tests {
+		v, err := vm.ValueOf(test.x);
+		if err != nil { t.Errorf("ValueOf(%#v): %s", test.x, err); continue; }
+		if v.Class() != test.class { t.Errorf("ValueOf(%#v) is a %s, expected a %s", test.x, v.Class(), test.class); }
+		if x := v.Interface(); !reflect.DeepEqual(x, test.expected) { t.Errorf("ValueOf(%#v).Interface() = %#v", test.x, x); }
+	}
+}
+
+func TestValueOfErrors(t *testing.T) {
+	vm := newTestVM(t);
+	if _, err := vm.ValueOf(make(chan int)); err == nil { t.Errorf("a chan shouldn't be converted"); }
+	if _, err := vm.ValueOf([]interface{}{1, make(chan int)}); err == nil { t.Errorf("the elements of a slice should be converted"); }
+	if _, err := vm.ValueOf(eval(t, newTestVM(t), "1")); err == nil { t.Errorf("a value of another VM shouldn't be used"); }
+	if v, err := vm.ValueOf(Value{}); err != nil || !v.IsNil() { t.Errorf("the zero Value should be nil"); }
+}
+
+func TestInterfaceOfRubyObjects(t *testing.T) {
+	vm := newTestVM(t);
+	if x := eval(t, vm, ":sym").Interface(); x != "sym" { t.Errorf("a Symbol should be its name, got %#v", x); }
+	if x := eval(t, vm, "{ [1] => 2 }").Interface(); len(x.(map[interface{}]interface{})) != 1 {
+		t.Errorf("a Hash with an Array key should keep it, got %#v", x);
+	}
+	if x := eval(t, vm, "Object.new").Interface(); reflect.TypeOf(x) != value_type { t.Errorf("other objects should stay Values, got %#v", x); }
+}
+
+func TestAsConversions(t *testing.T) {
+	vm := newTestVM(t);
+	if n, err := eval(t, vm, "6 * 7").AsInt(); err != nil || n != 42 { t.Errorf("AsInt: %d, %v", n, err); }
+	if _, err := eval(t, vm, "1180591620717411303424").AsInt(); err == nil { t.Errorf("a Bignum too big for an int should fail"); }
+	if _, err := eval(t, vm, "'42'").AsInt(); err == nil { t.Errorf("a String isn't an Integer"); }
+	if f, err := eval(t, vm, "2").AsFloat(); err != nil || f != 2 { t.Errorf("AsFloat of an Integer: %v, %v", f, err); }
+	if f, err := eval(t, vm, "0.25").AsFloat(); err != nil || f != 0.25 { t.Errorf("AsFloat: %v, %v", f, err); }
+	if s, err := eval(t, vm, ":name").AsString(); err != nil || s != "name" { t.Errorf("AsString of a Symbol: %q, %v", s, err); }
+	if _, err := eval(t, vm, "nil").AsString(); err == nil { t.Errorf("nil isn't a String"); }
+	items, err := eval(t, vm, "[1, 'two']").AsSlice();
+	if err != nil || len(items) != 2 || items[1].String() != "two" { t.Errorf("AsSlice: %v, %v", items, err); }
+	pairs, err := eval(t, vm, "{ :a => 1 }").AsMap();
+	if err != nil || len(pairs) != 1 { t.Errorf("AsMap: %v, %v", pairs, err); }
+	if _, err := (Value{}).AsInt(); err == nil { t.Errorf("the zero Value isn't an Integer"); }
+}
+
+func TestConst(t *testing.T) {
+	vm := newTestVM(t);
+	eval(t, vm, "module Outer; Inner = 42; end");
+	for _, name := range []string{"Outer::Inner", "::Outer::Inner"} {
+		if v, err := vm.Const(name); err != nil || v.Interface() != 42 { t.Errorf("Const(%q): %v, %v", name, v, err); }
+	}
+	if v, err := vm.Const("::Outer"); err != nil || v.Class() != "Module" { t.Errorf("Const(\"::Outer\"): %v, %v", v, err); }
+	var e *RubyError;
+	if _, err := vm.Const("Missing"); !errors.As(err, &e) || e.Class != "NameError" { t.Errorf("a missing constant should raise NameError, got %v", err); }
+	if _, err := vm.Const("Outer::Inner::Deeper"); !errors.As(err, &e) || e.Class != "TypeError" { t.Errorf("a constant of a non-module should raise TypeError, got %v", err); }
+}
+
+func TestRubyError(t *testing.T) {
+	vm := newTestVM(t);
+	_, err := vm.Eval("def fails\n  raise ArgumentError, 'bad'\nend\nfails\n", "fails.rb");
+	var e *RubyError;
+	if !errors.As(err, &e) { t.Fatalf("expected a *RubyError, got %v", err); }
+	if e.Class != "ArgumentError" || e.Message != "bad" || err.Error() != "ArgumentError: bad" { t.Errorf("wrong error: %v", e); }
+	if len(e.Backtrace) == 0 { t.Errorf("the error should have the backtrace of the exception"); }
+	if e.Exception.Class() != "ArgumentError" { t.Errorf("the error should hold the exception"); }
+	if e.Unwrap() != nil { t.Errorf("an exception raised by Ruby code wraps no Go error"); }
+	// the VM goes on after an error
+	if v := eval(t, vm, "1 + 1"); v.Interface() != 2 { t.Errorf("the VM should go on after an error"); }
+}
+
+func TestRubyErrorUnwrap(t *testing.T) {
+	vm := newTestVM(t);
+	failure := errors.New("disk full");
+	if err := vm.DefineFunction("save", func() error { return failure; }); err != nil { t.Fatal(err); }
+	_, err := vm.Eval("save", "(test)");
+	if !errors.Is(err, failure) { t.Errorf("the error should wrap the one of the Go func, got %v", err); }
+	var e *RubyError;
+	if !errors.As(err, &e) || e.Class != "RuntimeError" || e.Message != "disk full" { t.Errorf("wrong error: %v", err); }
+
+	// rescued and raised again it's still the same exception
+	_, err = vm.Eval("begin\n  save\nrescue => e\n  raise e\nend\n", "(test)");
+	if !errors.Is(err, failure) { t.Errorf("the error should survive a rescue, got %v", err); }
+}
@@ -75,11 +75,67 @@ func (self *Array) length(vm *RubyVM) RubyObject {
 	return TR_INT2FIX(self.kv.Len());
 }
 
+// Spreads value over the count registers of dest for a multiple assignment: the elements of value if it's
+// an Array or responds to to_ary, value itself otherwise. If splat > 0, dest[splat-1] gets an Array of the
+// elements the other targets leave.
+func TrArray_unpack(vm *RubyVM, value *RubyObject, count, splat int, dest []RubyObject) RubyObject {
+	ary := value;
+	if TR_IMMEDIATE(value) || !value.(Array) {
+		ary = vm.newArray2(1, value);
+		to_ary := TrSymbol_new(vm, "to_ary");
+		if Object_method(vm, value, to_ary) != TR_NIL {
+			ary = Object_send(vm, value, 1, { to_ary });
+			if ary == TR_UNDEF { return TR_UNDEF; }
+			if TR_IMMEDIATE(ary) || !ary.(Array) {
+				vm.throw_reason = TR_THROW_EXCEPTION;
+				vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "can't convert %s to Array (%s#to_ary gives %s)", Class *(Object_class(vm, value)).name.ptr, Class *(Object_class(vm, value)).name.ptr, Class *(Object_class(vm, ary)).name.ptr));
+				return TR_UNDEF;
+			}
+		}
+	}
+	values := Array *(ary).values;
+	size := values.Len();
+	pre := count;
+	if splat > 0 { pre = splat - 1; }
+	for n := 0; n < pre; n++ {
+		if n < size { dest[n] = values.At(n); } else { dest[n] = TR_NIL; }
+	}
+	if splat > 0 {
+		// a, *b, c = 1, 2, 3, 4 leaves 1 and 4 to a and c
+		post := count - splat;
+		rest := vm.newArray();
+		for n := pre; n < size - post; n++ { rest.Push(values.At(n)); }
+		dest[pre] = rest;
+		for n := 0; n < post; n++ {
+			at := size - post + n;
+			if at >= pre { dest[splat + n] = values.At(at); } else { dest[splat + n] = TR_NIL; }
+		}
+	}
+	return ary;
+}
+
+func TrArray_length(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Array *(self).length(vm);
+}
+
+func TrArray_push(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	Array *(self).Push(args[0]);
+	return self;
+}
+
+func TrArray_at(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Array *(self).At(args[0]);
+}
+
+func TrArray_set(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Array *(self).set(vm, args[0], args[1]);
+}
+
 void TrArray_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Array] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Array), newClass(vm, TrSymbol_new(vm, Array), vm.classes[TR_T_Object]));
-	c.add_method(vm, TrSymbol_new(vm, "length"), newMethod(vm, (TrFunc *)TrArray_length, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "size"), newMethod(vm, (TrFunc *)TrArray_length, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "<<"), newMethod(vm, (TrFunc *)Push, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "[]"), newMethod(vm, (TrFunc *)TrArray_at, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "[]="), newMethod(vm, (TrFunc *)TrArray_set, TR_NIL, 2));
+	c.add_method(vm, TrSymbol_new(vm, "length"), newMethod(vm, TrArray_length, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "size"), newMethod(vm, TrArray_length, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "<<"), newMethod(vm, TrArray_push, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "[]"), newMethod(vm, TrArray_at, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "[]="), newMethod(vm, TrArray_set, TR_NIL, 2));
 }
\ No newline at end of file
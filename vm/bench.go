@@ -0,0 +1,220 @@
+import (
+	"encoding/json";
+	"fmt";
+	"io";
+	"math";
+	"os";
+	"path/filepath";
+	"runtime";
+	"strconv";
+	"strings";
+	"time";
+	"tr";
+)
+
+const (
+	TR_BENCH_DIR = "bench";
+	TR_BENCH_ITERATIONS = 3;
+	TR_BENCH_THRESHOLD = 5.0;		// percent a benchmark can get slower before it's a regression
+)
+
+// Measures of a benchmark. Times are in seconds, the other measures are per iteration: they're
+// the same for each one but allocations, which the GC can change a bit.
+type BenchResult struct {
+	Name			string		`json:"name"`;
+	Iterations		int			`json:"iterations"`;
+	Times			[]float64	`json:"times"`;
+	Min				float64		`json:"min"`;
+	Mean			float64		`json:"mean"`;
+	Instructions	uint64		`json:"instructions"`;
+	Allocations		uint64		`json:"allocations"`;
+	AllocatedBytes	uint64		`json:"allocated_bytes"`;
+	CacheHits		uint64		`json:"cache_hits"`;
+	CacheMisses		uint64		`json:"cache_misses"`;
+}
+
+// Returns the part of calls whose method was found in the inline cache of their site.
+func (r *BenchResult) HitRate() float64 {
+	if r.CacheHits + r.CacheMisses == 0 { return 0; }
+	return float64(r.CacheHits) / float64(r.CacheHits + r.CacheMisses);
+}
+
+type BenchReport struct {
+	Version			string			`json:"version"`;
+	Date			string			`json:"date"`;
+	Benchmarks		[]*BenchResult	`json:"benchmarks"`;
+}
+
+// Runs a benchmark once in a VM of its own, what it prints is discarded. The VM is created before
+// measuring, so loading the core library isn't part of the results.
+func run_bench_once(file string, r *BenchResult) RubyObject {
+	vm := newRubyVM();
+	vm.out = io.Discard;
+	var before, after runtime.MemStats;
+	runtime.GC();
+	runtime.ReadMemStats(&before);
+	// booting ran code too, only the benchmark is counted
+	vm.instructions, vm.cache_hits, vm.cache_misses = 0, 0, 0;
+	start := time.Now();
+	result := vm.load(file);
+	elapsed := time.Since(start).Seconds();
+	runtime.ReadMemStats(&after);
+
+	if result == TR_UNDEF && vm.throw_reason == TR_THROW_EXCEPTION {
+		vm.out = os.Stderr;
+		TrException_report(vm, vm.throw_value);
+		return TR_UNDEF;
+	}
+	r.Times = append(r.Times, elapsed);
+	r.Instructions = vm.instructions;
+	r.CacheHits, r.CacheMisses = vm.cache_hits, vm.cache_misses;
+	r.Allocations += after.Mallocs - before.Mallocs;
+	r.AllocatedBytes += after.TotalAlloc - before.TotalAlloc;
+	return TR_NIL;
+}
+
+// Runs a benchmark iterations times, one after the other so they don't compete for the CPU.
+// Returns nil if it raised.
+func run_bench(file string, iterations int) *BenchResult {
+	r := &BenchResult{Name: strings.TrimPrefix(strings.TrimSuffix(filepath.Base(file), ".rb"), "bm_"), Iterations: iterations};
+	for n := 0; n < iterations; n++ {
+		if run_bench_once(file, r) == TR_UNDEF { return nil; }
+	}
+	r.Min = r.Times[0];
+	total := 0.0;
+	for _, t := range r.Times {
+		if t < r.Min { r.Min = t; }
+		total += t;
+	}
+	r.Mean = total / float64(iterations);
+	r.Allocations /= uint64(iterations);
+	r.AllocatedBytes /= uint64(iterations);
+	return r;
+}
+
+func read_bench_report(filename string) (*BenchReport, error) {
+	data, err := os.ReadFile(filename);
+	if err != nil { return nil, err; }
+	report := new(BenchReport);
+	if err := json.Unmarshal(data, report); err != nil { return nil, fmt.Errorf("%s: %s", filename, err); }
+	return report, nil;
+}
+
+// Returns how much after changed from before in percent, false if before is 0 and there's no
+// telling.
+func percent_change(before, after float64) (float64, bool) {
+	if before == 0 { return math.NaN(), false; }
+	return (after - before) / before * 100, true;
+}
+
+// Formats a percent_change in width columns, - if there's none.
+func change_string(change float64, width int) string {
+	if math.IsNaN(change) { return "-"; }
+	return fmt.Sprintf("%+*.1f%%", width, change);
+}
+
+// Prints how each benchmark of current changed since baseline. Returns the number of benchmarks
+// whose best time got slower by more than threshold percent.
+func compare_bench(baseline, current *BenchReport, threshold float64) int {
+	before := make(map[string] *BenchResult);
+	for _, r := range baseline.Benchmarks { before[r.Name] = r; }
+	regressions := 0;
+	fmt.Printf("%-24s %10s %10s %8s %14s\n", "benchmark", "before", "after", "change", "instructions");
+	for _, r := range current.Benchmarks {
+		old, ok := before[r.Name];
+		if !ok {
+			fmt.Printf("%-24s %10s %9.3fs %8s\n", r.Name, "-", r.Min, "new");
+			continue;
+		}
+		change, ok := percent_change(old.Min, r.Min);
+		instructions, _ := percent_change(float64(old.Instructions), float64(r.Instructions));
+		flag := "";
+		if ok && change > threshold {
+			flag = "  REGRESSION";
+			regressions++;
+		}
+		fmt.Printf("%-24s %9.3fs %9.3fs %8s %14s%s\n", r.Name, old.Min, r.Min, change_string(change, 7), change_string(instructions, 13), flag);
+	}
+	fmt.Println();
+	fmt.Printf("%d regressions over %.1f%%\n", regressions, threshold);
+	return regressions;
+}
+
+// tinyrb bench [-n iterations] [-o results.json] [pattern]
+// tinyrb bench compare [-t threshold] baseline.json current.json
+// Runs bench/bm_*.rb, the ones whose name after bm_ matches pattern if given, from the root of the source
+// tree, or compares two results written with -o. Returns 1 if a benchmark fails or regressed.
+func bench_main(args []string) int {
+	iterations, output, threshold := TR_BENCH_ITERATIONS, "", TR_BENCH_THRESHOLD;
+	compare := len(args) > 0 && args[0] == "compare";
+	if compare { args = args[1:]; }
+	files := make([]string, 0, 2);
+	for n := 0; n < len(args); n++ {
+		arg := args[n];
+		if arg == "-n" || arg == "-o" || arg == "-t" {
+			if n + 1 == len(args) { return usage(); }
+			n++;
+			switch arg {
+				case "-n":
+					var err error;
+					if iterations, err = strconv.Atoi(args[n]); err != nil || iterations < 1 { return usage(); }
+				case "-o":
+					output = args[n];
+				case "-t":
+					var err error;
+					if threshold, err = strconv.ParseFloat(args[n], 64); err != nil { return usage(); }
+			}
+		} else if strings.HasPrefix(arg, "-") {
+			return usage();
+		} else {
+			files = append(files, arg);
+		}
+	}
+
+	if compare {
+		if len(files) != 2 { return usage(); }
+		var current *BenchReport;
+		baseline, err := read_bench_report(files[0]);
+		if err == nil {
+			current, err = read_bench_report(files[1]);
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tinyrb: %s\n", err);
+			return 1;
+		}
+		if compare_bench(baseline, current, threshold) > 0 { return 1; }
+		return 0;
+	}
+
+	pattern := "*";
+	if len(files) == 1 { pattern = files[0]; } else if len(files) > 1 { return usage(); }
+	benchmarks, err := filepath.Glob(filepath.Join(TR_BENCH_DIR, "bm_" + pattern + ".rb"));
+	if err != nil || len(benchmarks) == 0 {
+		fmt.Fprintf(os.Stderr, "tinyrb: no benchmark matches %s in %s\n", pattern, TR_BENCH_DIR);
+		return 1;
+	}
+
+	report := &BenchReport{Version: TR_VERSION, Date: time.Now().UTC().Format(time.RFC3339)};
+	failed := false;
+	fmt.Printf("%-24s %9s %9s %14s %12s %9s\n", "benchmark", "min", "mean", "instructions", "allocations", "cache hits");
+	for _, file := range benchmarks {
+		r := run_bench(file, iterations);
+		if r == nil {
+			failed = true;
+			continue;
+		}
+		fmt.Printf("%-24s %8.3fs %8.3fs %14d %12d %8.1f%%\n", r.Name, r.Min, r.Mean, r.Instructions, r.Allocations, r.HitRate() * 100);
+		report.Benchmarks = append(report.Benchmarks, r);
+	}
+
+	if output != "" {
+		data, err := json.MarshalIndent(report, "", "  ");
+		if err == nil { err = os.WriteFile(output, append(data, '\n'), 0644); }
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tinyrb: %s\n", err);
+			return 1;
+		}
+	}
+	if failed { return 1; }
+	return 0;
+}
@@ -0,0 +1,27 @@
+package RubyVM
+
+import (
+	"testing";
+)
+
+func TestCompareBench(t *testing.T) {
+	baseline := &BenchReport{Benchmarks: []*BenchResult{
+		&BenchResult{Name: "fib", Min: 1.0, Instructions: 1000},
+		&BenchResult{Name: "empty", Min: 0, Instructions: 0},
+	}};
+	current := &BenchReport{Benchmarks: []*BenchResult{
+		&BenchResult{Name: "fib", Min: 1.2, Instructions: 1000},
+		&BenchResult{Name: "empty", Min: 0.5, Instructions: 10},
+		&BenchResult{Name: "new", Min: 1.0},
+	}};
+	// only fib got slower, there's no telling for empty
+	if regressions := compare_bench(baseline, current, 5.0); regressions != 1 { t.Errorf("expected 1 regression, got %d", regressions); }
+	if regressions := compare_bench(baseline, current, 25.0); regressions != 0 { t.Errorf("20%% is under a 25%% threshold, got %d regressions", regressions); }
+}
+
+func TestPercentChange(t *testing.T) {
+	if change, ok := percent_change(2, 3); !ok || change != 50 { t.Errorf("percent_change(2, 3) = %v, %v", change, ok); }
+	if _, ok := percent_change(0, 3); ok { t.Errorf("a change from 0 has no percent"); }
+	if s := change_string(-12.5, 7); s != "  -12.5%" { t.Errorf("change_string(-12.5, 7) = %q", s); }
+	if _, ok := percent_change(0, 0); ok { t.Errorf("a change from 0 has no percent"); }
+}
@@ -0,0 +1,176 @@
+import (
+	"tr";
+	"math/big";
+)
+
+type Bignum struct {
+	type			TR_T;
+	class			*RubyObject;
+	ivars			map[string] RubyObject;
+	value			*big.Int;
+}
+
+func TrBignum_new(vm *RubyVM, value *big.Int) RubyObject {
+	return Bignum{type: TR_T_Bignum, class: vm.classes[TR_T_Bignum], ivars: make(map[string] RubyObject), value: value};
+}
+
+// Returns n as a Fixnum if it fits, so results of Bignum operations are always normalized.
+func TrBignum_normalize(vm *RubyVM, n *big.Int) RubyObject {
+	if n.Cmp(big.NewInt(TR_FIX_MIN)) >= 0 && n.Cmp(big.NewInt(TR_FIX_MAX)) <= 0 { return TR_INT2FIX(int(n.Int64())); }
+	return TrBignum_new(vm, n);
+}
+
+// Returns the value of a Fixnum or Bignum as a big.Int, or nil for any other object.
+func TrInteger_to_big(obj *RubyObject) *big.Int {
+	if TR_IS_FIX(obj) { return big.NewInt(int64(TR_FIX2INT(obj))); }
+	if !TR_IMMEDIATE(obj) && obj.(Bignum) { return Bignum *(obj).value; }
+	return nil;
+}
+
+// Does self op other when other isn't an integer: with a Float the operation is done on Floats,
+// other objects are asked to coerce.
+func TrInteger_coerce(vm *RubyVM, self, other, op *RubyObject) RubyObject {
+	if !TR_IMMEDIATE(other) && other.(Float) {
+		x, _ := TrNumeric_to_float(self);
+		return Object_send(vm, TrFloat_new(vm, x), 2, { op, other });
+	}
+	return TrNumeric_coerce(vm, self, other, op);
+}
+
+func TrBignum_add(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sADD); }
+	return TrBignum_normalize(vm, new(big.Int).Add(TrInteger_to_big(self), y));
+}
+
+func TrBignum_sub(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sSUB); }
+	return TrBignum_normalize(vm, new(big.Int).Sub(TrInteger_to_big(self), y));
+}
+
+func TrBignum_mul(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sMUL); }
+	return TrBignum_normalize(vm, new(big.Int).Mul(TrInteger_to_big(self), y));
+}
+
+// Divides rounding toward negative infinity like Fixnum, returns the quotient and the modulo.
+func TrBignum_divmod(vm *RubyVM, self *RubyObject, y *big.Int) (*big.Int, *big.Int) {
+	if y.Sign() == 0 {
+		TrFixnum_zero_division(vm);
+		return nil, nil;
+	}
+	q, m := new(big.Int).QuoRem(TrInteger_to_big(self), y, new(big.Int));
+	if m.Sign() != 0 && (m.Sign() < 0) != (y.Sign() < 0) {
+		q.Sub(q, big.NewInt(1));
+		m.Add(m, y);
+	}
+	return q, m;
+}
+
+func TrBignum_div(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sDIV); }
+	q, _ := TrBignum_divmod(vm, self, y);
+	if q == nil { return TR_UNDEF; }
+	return TrBignum_normalize(vm, q);
+}
+
+func TrBignum_mod(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sMOD); }
+	q, m := TrBignum_divmod(vm, self, y);
+	if q == nil { return TR_UNDEF; }
+	return TrBignum_normalize(vm, m);
+}
+
+func TrBignum_neg(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TrBignum_normalize(vm, new(big.Int).Neg(TrInteger_to_big(self)));
+}
+
+func TrBignum_eq(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if n := TrInteger_to_big(other); n != nil { return TR_BOOL(TrInteger_to_big(self).Cmp(n) == 0); }
+	if !TR_IMMEDIATE(other) && other.(Float) { return TrInteger_coerce(vm, self, other, vm.sEQ); }
+	return TR_FALSE;
+}
+
+func TrBignum_lt(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sLT); }
+	return TR_BOOL(TrInteger_to_big(self).Cmp(y) < 0);
+}
+
+func TrBignum_le(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sLE); }
+	return TR_BOOL(TrInteger_to_big(self).Cmp(y) <= 0);
+}
+
+func TrBignum_gt(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sGT); }
+	return TR_BOOL(TrInteger_to_big(self).Cmp(y) > 0);
+}
+
+func TrBignum_ge(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	y := TrInteger_to_big(other);
+	if y == nil { return TrInteger_coerce(vm, self, other, vm.sGE); }
+	return TR_BOOL(TrInteger_to_big(self).Cmp(y) >= 0);
+}
+
+func TrInteger_to_f(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	value, _ := TrNumeric_to_float(self);
+	return TrFloat_new(vm, value);
+}
+
+func TrInteger_to_i(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return self;
+}
+
+// Returns [other, self] as Floats if other is a Float, else as they are.
+func TrInteger_coerce_pair(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TrInteger_to_big(other) != nil { return vm.newArray2(2, other, self); }
+	if !TR_IMMEDIATE(other) && other.(Float) { return vm.newArray2(2, other, TrInteger_to_f(vm, self, nil, nil)); }
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "%s can't be coerced into %s", Class *(Object_class(vm, other)).name.ptr, Class *(Object_class(vm, self)).name.ptr));
+	return TR_UNDEF;
+}
+
+func TrBignum_to_s(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TrString_new2(vm, Bignum *(self).value.String());
+}
+
+func TrBignum_init(vm *RubyVM) {
+	c := vm.classes[TR_T_Bignum] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Bignum), newClass(vm, TrSymbol_new(vm, Bignum), vm.classes[TR_T_Object]));
+	c.add_method(vm, TrSymbol_new(vm, "+"), newMethod(vm, TrBignum_add, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "-"), newMethod(vm, TrBignum_sub, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "*"), newMethod(vm, TrBignum_mul, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "/"), newMethod(vm, TrBignum_div, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "%"), newMethod(vm, TrBignum_mod, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "@-"), newMethod(vm, TrBignum_neg, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "=="), newMethod(vm, TrBignum_eq, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "<"), newMethod(vm, TrBignum_lt, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "<="), newMethod(vm, TrBignum_le, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, ">"), newMethod(vm, TrBignum_gt, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, ">="), newMethod(vm, TrBignum_ge, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrBignum_to_s, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "inspect"), newMethod(vm, TrBignum_to_s, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_f"), newMethod(vm, TrInteger_to_f, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_i"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "floor"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "ceil"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "round"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "coerce"), newMethod(vm, TrInteger_coerce_pair, TR_NIL, 1));
+}
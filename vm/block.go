@@ -12,16 +12,46 @@ type Block struct {
 	locals		Vector;
 	upvals		Vector;
 	code		Vector;
+	line_table	Vector;			// LineEntry of each run of instructions on the same line and column
+	covered		int;			// instructions of code line_table has a position for
 	defaults	Vector;
 	blocks		[]Block;
 	regc		int;
 	argc		int;
 	arg_splat	int;
+	arg_block	bool;			// &block param, stored in the local following the args
 	filename	RubyObject;
 	line		int;
 	parent 		*Block;
-	// dynamic
-	sites		Vector;
+	handlers	Vector;
+	ensure		int;			// depth of ensure clauses being compiled
+	sites		Vector;			// inline caches of the LOOKUP and SUPER instructions
+	loop		*Loop;			// innermost while or until being compiled
+}
+
+// A rescue or ensure handler protecting the instructions in [start, end) of a block.
+type Handler struct {
+	start		int;
+	end			int;
+	handler		int;			// first instruction of the handler code
+	reg			int;			// R[reg] receives the thrown value, and for ensure, R[reg+1] the reason
+	ensure		bool;			// run on any throw, not only on exceptions
+}
+
+// The source position of the instructions in code from pc to the pc of the next entry.
+type LineEntry struct {
+	pc			int;
+	line		int;
+	column		int;			// 0 when unknown
+}
+
+// A while or until loop being compiled, break jumps to its end and next back to its condition.
+type Loop struct {
+	reg			int;			// register receiving the value of the loop
+	start		int;			// first instruction of the condition
+	breaks		Vector;			// jumps to patch to the end of the loop
+	ensure		int;			// depth of ensure clauses when the loop started
+	outer		*Loop;
 }
 
 func (compiler *Compiler) newBlock(parent *Block) *Block {
@@ -31,7 +61,9 @@ func (compiler *Compiler) newBlock(parent *Block) *Block {
 					locals: 	Vector.new(0),
 					upvals:		Vector.new(0),
 					code:		Vector.new(0),
+					line_table:	Vector.new(0),
 					defaults:	Vector.new(0),
+					handlers:	Vector.new(0),
 					sites:		Vector.new(0),
 					blocks:		Vector.new(0),
 					regc:		0,
@@ -41,122 +73,47 @@ func (compiler *Compiler) newBlock(parent *Block) *Block {
 				 }
 }
 
+// Prints the listing of the block and its nested blocks, see Block_disassemble.
 func (b *Block) dump(vm *RubyVM, level int) RubyObject {
-	char buf[10];
-  
-	size_t i;
-	fmt.Println("; block definition: %p (level %d)", b, level);
-	fmt.Println("; %lu registers ; %lu nested blocks", b.regc, b.blocks.Len());
-	fmt.Printf("; %lu args ", b.argc);
-	if (b.arg_splat) { fmt.Printf(", splat"); }
-	fmt.Println()
-	if b.defaults.Len > 0 {
-		fmt.Printf("; defaults table: ");
-		for (i = 0; i < b.defaults.Len; ++i) fmt.Printf("%d ", b.defaults.At(i));
-		fmt.Println();
-	}
-	for (i = 0; i < b.locals.Len(); ++i) {
-		local := b.locals.At(i);
-		if local.(Symbol) {
-			local := local.ptr;
-		} else {
-			sprintf(buf, "%d", TR_FIX2INT(local));
-			local := buf;
-		}
-		fmt.Println(".local  %-8s ; %lu", local, i);
-	}
-	for (i = 0; i < b.upvals.Len(); ++i) {
-		upval := b.upvals.At(i);
-		if upval.(Symbol) {
-			upval := upval.ptr;
-		} else {
-			sprintf(buf, "%d", TR_FIX2INT(upval));
-			upval := buf;
-		}
-		fmt.Println(".upval  %-8s ; %lu", upval, i);
-	}
-	for (i = 0; i < b.k.Len(); ++i) {
-		k := b.k.At(i);
-		if k.(Symbol) {
-			k := k.ptr;
-		} else {
-			sprintf(buf, "%d", TR_FIX2INT(k));
-			k := buf;
-		}
-		fmt.Println(".value  %-8s ; %lu",k, i);
+	fmt.Fprint(vm.out, Block_disassemble(vm, b).Text());
+	return TR_NIL;
+}
+
+// Returns the number of args the block takes at least and at most, max being -1 for no limit.
+func (block *Block) arg_range() (int, int) {
+	switch {
+		case block.arg_splat:				return block.argc - block.defaults.Len() - 1, -1;
+		case block.defaults.Len() > 0:		return block.argc - block.defaults.Len(), block.argc;
 	}
-	for (i = 0; i < b.strings.Len; ++i) {
-		fmt.Println(".string %-8s ; %lu", b.strings.At(i), i);
+	return block.argc, block.argc;
+}
+
+// Gives the instructions emitted since the last call the position line and column.
+func (block *Block) mark_lines(line, column int) {
+	if block.covered == block.code.Len() { return; }
+	n := block.line_table.Len();
+	if n == 0 || block.line_table.At(n - 1).line != line || block.line_table.At(n - 1).column != column {
+		block.line_table.Push(LineEntry{pc: block.covered, line: line, column: column});
 	}
-	for (i = 0; i < b.code.Len(); ++i) {
-		op := b.code.At(i);
-		fmt.printf("[%03lu] %-10s %3d %3d %3d", i, OPCODE_NAMES[op.OpCode], op.A, op.B, op.C);
-		switch (op.OpCode) {
-			case TR_OP_LOADK:
-				k := b.k.At(op.Get_Bx());
-				if k.(Symbol) {
-					k := k.ptr;
-				} else {
-					sprintf(buf, "%d", TR_FIX2INT(k));
-					k := buf;
-				}
-				fmt.Printf(" ; R[%d] = %s", op.A, k);
-
-			case TR_OP_STRING:
-				fmt.Printf(" ; R[%d] = \"%s\"", op.A, b.strings.At(op.Get_Bx()));
-
-			case TR_OP_LOOKUP:
-				k := b.l.At(op.Get_Bx());
-				if k.(Symbol) {
-					k := k.ptr;
-				} else {
-					sprintf(buf, "%d", TR_FIX2INT(k));
-					k := buf;
-				}
-				fmt.Printf(" ; R[%d] = R[%d].method(:%s)", op.A + 1, op.A, k);
-
-			case TR_OP_CALL:
-				fmt.Printf(" ; R[%d] = R[%d].R[%d](%d)", op.A, op.A, op.A + 1, op.B >> 1);
-
-			case TR_OP_SETUPVAL:
-				upval := b.upvals.At(op.B);
-				if upval.(Symbol) {
-					upval := upval.ptr;
-				} else {
-					sprintf(buf, "%d", TR_FIX2INT(upval));
-					upval := buf;
-				}
-				fmt.Printf(" ; %s = R[%d]", upval, op.A);
-
-			case TR_OP_GETUPVAL:
-				upval := b.upvals.At(op.B);
-				if upval.(Symbol) {
-					upval := upval.ptr;
-				} else {
-					sprintf(buf, "%d", TR_FIX2INT(upval));
-					upval := buf;
-				}
-				fmt.Printf(" ; R[%d] = %s", op.A, upval);
-
-			case TR_OP_JMP:
-				fmt.Printf(" ; %d", op.Get_sBx());
-
-			case TR_OP_DEF:
-				k := b.k.At(op.Get_Bx());
-				if k.(Symbol) {
-					k := k.ptr;
-				} else {
-					sprintf(buf, "%d", TR_FIX2INT(k));
-					k := buf;
-				}
-				fmt.Printf(" ; %s => %p", k, b.blocks.At(op.A));
-		}
-		fmt.Println();
+	block.covered = block.code.Len();
+}
+
+// Returns the source line and column of the instruction at index pc in code.
+func (block *Block) position_at(pc int) (int, int) {
+	// the last entry starting at or before pc
+	lo, hi := 0, block.line_table.Len();
+	for lo < hi {
+		mid := (lo + hi) / 2;
+		if block.line_table.At(mid).pc <= pc { lo = mid + 1; } else { hi = mid; }
 	}
-	fmt.Println("; block end\n");
+	if lo == 0 { return block.line, 0; }
+	entry := block.line_table.At(lo - 1);
+	return entry.line, entry.column;
+}
 
-	for (i = 0; i < b.blocks.Len(); ++i) { b.blocks.At(i).dump(vm, level+1); }
-	return TR_NIL;
+func (block *Block) line_at(pc int) int {
+	line, _ := block.position_at(pc);
+	return line;
 }
 
 func (block *Block) push_value(k *RubyObject) int {
@@ -219,4 +176,12 @@ func (block *Block) push_upval(name *RubyObject) int {
 		b = b.parent;
 	}
 	return block.upvals.Len()-1;
-}
\ No newline at end of file
+}
+
+// Emits a call of method name on R[reg] with argc args starting at R[reg+2], through its own inline cache.
+func (block *Block) push_send(reg int, name *RubyObject, argc int) {
+	block.sites.Push(new(TrInlineCache));
+	block.code.Push(newExtendedOP(TR_OP_CACHE, reg, block.sites.Len() - 1));
+	block.code.Push(newExtendedOP(TR_OP_LOOKUP, reg, block.push_value(name)));
+	block.code.Push(MachineOp{OpCode: TR_OP_CALL, A: reg, B: argc << 1});
+}
@@ -0,0 +1,394 @@
+import (
+	"bytes";
+	"encoding/binary";
+	"fmt";
+	"hash/crc32";
+	"math";
+	"math/big";
+	"os";
+	"strings";
+	"tr";
+	"opcode";
+)
+
+/*
+== Bytecode files (.trc)
+A compiled Block tree, so a file can be loaded without parsing it again.
+
+  magic           "TRBC"
+  version         uint16    TR_BYTECODE_VERSION of the VM that wrote it
+  opcodes         uint16    number of opcodes of that VM
+  source crc      uint32    CRC-32 of the .rb it was compiled from
+  payload size    uint32
+  payload crc     uint32    CRC-32 of the payload
+  payload                   the main Block
+
+Integers in the payload are varints. A Block is its filename, line, regc, argc, arg_splat,
+arg_block, then the k, strings, locals, upvals, code, line_table, defaults and handlers tables,
+each prefixed by its length, the number of inline caches and the nested blocks.
+Values in k, locals and upvals are prefixed by one of the TR_BC_* tags.
+
+Files of another version, of a VM with different opcodes or with a payload not matching its
+checksum are rejected.
+*/
+
+const (
+	TR_BYTECODE_MAGIC = "TRBC";
+	TR_BYTECODE_VERSION = 3;			// bump when the format or the meaning of an opcode changes
+	TR_BYTECODE_HEADER = 20;
+	)
+
+const (
+	TR_BC_NIL = iota;
+	TR_BC_TRUE;
+	TR_BC_FALSE;
+	TR_BC_FIXNUM;
+	TR_BC_BIGNUM;
+	TR_BC_FLOAT;
+	TR_BC_SYMBOL;
+	TR_BC_REGEXP;
+	)
+
+type BytecodeWriter struct {
+	buf			bytes.Buffer;
+}
+
+func (w *BytecodeWriter) uint(n int) {
+	var tmp [binary.MaxVarintLen64]byte;
+	w.buf.Write(tmp[0:binary.PutUvarint(tmp[0:], uint64(n))]);
+}
+
+func (w *BytecodeWriter) int(n int) {
+	var tmp [binary.MaxVarintLen64]byte;
+	w.buf.Write(tmp[0:binary.PutVarint(tmp[0:], int64(n))]);
+}
+
+func (w *BytecodeWriter) string(s string) {
+	w.uint(len(s));
+	w.buf.WriteString(s);
+}
+
+func (w *BytecodeWriter) value(vm *RubyVM, v *RubyObject) error {
+	switch {
+		case v == TR_NIL:
+			w.uint(TR_BC_NIL);
+		case v == TR_TRUE:
+			w.uint(TR_BC_TRUE);
+		case v == TR_FALSE:
+			w.uint(TR_BC_FALSE);
+		case TR_IS_FIX(v):
+			w.uint(TR_BC_FIXNUM);
+			w.int(TR_FIX2INT(v));
+		case v.(Bignum):
+			w.uint(TR_BC_BIGNUM);
+			w.string(Bignum *(v).value.String());
+		case v.(Float):
+			w.uint(TR_BC_FLOAT);
+			var bits [8]byte;
+			binary.LittleEndian.PutUint64(bits[0:], math.Float64bits(Float *(v).value));
+			w.buf.Write(bits[0:]);
+		case v.(Symbol):
+			w.uint(TR_BC_SYMBOL);
+			w.string(v.ptr);
+		case v.(Regexp):
+			w.uint(TR_BC_REGEXP);
+			w.string(TrRegexp *(v).source);
+			w.uint(TrRegexp *(v).options);
+		default:
+			return fmt.Errorf("can't serialize a %s", Class *(Object_class(vm, v)).name.ptr);
+	}
+	return nil;
+}
+
+func (w *BytecodeWriter) values(vm *RubyVM, values Vector) error {
+	w.uint(values.Len());
+	for _, v := range values.Iter() {
+		if err := w.value(vm, v); err != nil { return err; }
+	}
+	return nil;
+}
+
+func (w *BytecodeWriter) block(vm *RubyVM, b *Block) error {
+	w.string(b.filename.ptr);
+	w.uint(b.line);
+	w.uint(b.regc);
+	w.uint(b.argc);
+	w.uint(b.arg_splat);
+	if b.arg_block { w.uint(1); } else { w.uint(0); }
+	if err := w.values(vm, b.k); err != nil { return err; }
+	w.uint(b.strings.Len());
+	for _, s := range b.strings.Iter() { w.string(s); }
+	if err := w.values(vm, b.locals); err != nil { return err; }
+	if err := w.values(vm, b.upvals); err != nil { return err; }
+	w.uint(b.code.Len());
+	for _, op := range b.code.Iter() { w.buf.Write([]byte{ op.OpCode, op.A, op.B, op.C }); }
+	w.uint(b.line_table.Len());
+	for _, entry := range b.line_table.Iter() {
+		w.uint(entry.pc);
+		w.uint(entry.line);
+		w.uint(entry.column);
+	}
+	w.uint(b.defaults.Len());
+	for _, d := range b.defaults.Iter() { w.uint(d); }
+	w.uint(b.handlers.Len());
+	for _, h := range b.handlers.Iter() {
+		w.uint(h.start);
+		w.uint(h.end);
+		w.uint(h.handler);
+		w.uint(h.reg);
+		if h.ensure { w.uint(1); } else { w.uint(0); }
+	}
+	w.uint(b.sites.Len());
+	w.uint(b.blocks.Len());
+	for _, blk := range b.blocks.Iter() {
+		if err := w.block(vm, blk); err != nil { return err; }
+	}
+	return nil;
+}
+
+// Returns the bytecode file of block, compiled from source.
+func Block_serialize(vm *RubyVM, block *Block, source []byte) ([]byte, error) {
+	w := new(BytecodeWriter);
+	if err := w.block(vm, block); err != nil { return nil, err; }
+	payload := w.buf.Bytes();
+	header := make([]byte, TR_BYTECODE_HEADER);
+	copy(header, TR_BYTECODE_MAGIC);
+	binary.LittleEndian.PutUint16(header[4:], TR_BYTECODE_VERSION);
+	binary.LittleEndian.PutUint16(header[6:], uint16(len(OPCODE_NAMES)));
+	binary.LittleEndian.PutUint32(header[8:], crc32.ChecksumIEEE(source));
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(payload)));
+	binary.LittleEndian.PutUint32(header[16:], crc32.ChecksumIEEE(payload));
+	return append(header, payload...), nil;
+}
+
+// Reads a payload, the first error sticks and makes every following read return zero.
+type BytecodeReader struct {
+	data		[]byte;
+	pos			int;
+	err			error;
+}
+
+func (r *BytecodeReader) fail(format string, args ...) {
+	if r.err == nil { r.err = fmt.Errorf(format, args...); }
+}
+
+func (r *BytecodeReader) uint() int {
+	if r.err != nil { return 0; }
+	n, size := binary.Uvarint(r.data[r.pos:]);
+	if size <= 0 || n > math.MaxInt32 {
+		r.fail("truncated bytecode");
+		return 0;
+	}
+	r.pos += size;
+	return int(n);
+}
+
+func (r *BytecodeReader) int() int {
+	if r.err != nil { return 0; }
+	n, size := binary.Varint(r.data[r.pos:]);
+	if size <= 0 {
+		r.fail("truncated bytecode");
+		return 0;
+	}
+	r.pos += size;
+	return int(n);
+}
+
+// Reads a table length, which can't be more than the bytes left as each entry takes at least one.
+func (r *BytecodeReader) count() int {
+	n := r.uint();
+	if n > len(r.data) - r.pos {
+		r.fail("truncated bytecode");
+		return 0;
+	}
+	return n;
+}
+
+func (r *BytecodeReader) bytes(n int) []byte {
+	if r.err != nil { return nil; }
+	if n > len(r.data) - r.pos {
+		r.fail("truncated bytecode");
+		return nil;
+	}
+	r.pos += n;
+	return r.data[r.pos - n:r.pos];
+}
+
+func (r *BytecodeReader) string() string {
+	return string(r.bytes(r.count()));
+}
+
+func (r *BytecodeReader) value(vm *RubyVM) RubyObject {
+	switch tag := r.uint() {
+		case TR_BC_NIL:
+			return TR_NIL;
+		case TR_BC_TRUE:
+			return TR_TRUE;
+		case TR_BC_FALSE:
+			return TR_FALSE;
+		case TR_BC_FIXNUM:
+			return TR_INT2FIX(r.int());
+		case TR_BC_BIGNUM:
+			n, ok := new(big.Int).SetString(r.string(), 10);
+			if !ok {
+				r.fail("invalid Bignum");
+				return TR_NIL;
+			}
+			return TrBignum_new(vm, n);
+		case TR_BC_FLOAT:
+			bits := r.bytes(8);
+			if bits == nil { return TR_NIL; }
+			return TrFloat_new(vm, math.Float64frombits(binary.LittleEndian.Uint64(bits)));
+		case TR_BC_SYMBOL:
+			return TrSymbol_new(vm, r.string());
+		case TR_BC_REGEXP:
+			source := r.string();
+			options := r.uint();
+			if r.err != nil { return TR_NIL; }
+			re := TrRegexp_new(vm, source, options);
+			if re == TR_UNDEF {
+				r.fail("invalid Regexp /%s/", source);
+				return TR_NIL;
+			}
+			return re;
+		default:
+			r.fail("unknown value tag %d", tag);
+	}
+	return TR_NIL;
+}
+
+func (r *BytecodeReader) values(vm *RubyVM) Vector {
+	values := Vector.New(0);
+	for n := r.count(); n > 0; n-- { values.Push(r.value(vm)); }
+	return values;
+}
+
+func (r *BytecodeReader) block(vm *RubyVM, parent *Block) *Block {
+	b := Block{	parent:		parent,
+				strings:	StringVector.new(0),
+				code:		Vector.new(0),
+				line_table:	Vector.new(0),
+				defaults:	Vector.new(0),
+				handlers:	Vector.new(0),
+				sites:		Vector.new(0),
+				blocks:		Vector.new(0),
+			  };
+	b.filename = TrString_new2(vm, r.string());
+	b.line = r.uint();
+	b.regc = r.uint();
+	b.argc = r.uint();
+	b.arg_splat = r.uint();
+	b.arg_block = r.uint() != 0;
+	b.k = r.values(vm);
+	for n := r.count(); n > 0; n-- { b.strings.Push(r.string()); }
+	b.locals = r.values(vm);
+	b.upvals = r.values(vm);
+	for n := r.count(); n > 0; n-- {
+		op := r.bytes(4);
+		if op == nil { break; }
+		if int(op[0]) >= len(OPCODE_NAMES) { r.fail("unknown opcode %d", op[0]); }
+		b.code.Push(MachineOp{OpCode: op[0], A: op[1], B: op[2], C: op[3]});
+	}
+	for n := r.count(); n > 0; n-- {
+		entry := LineEntry{pc: r.uint(), line: r.uint(), column: r.uint()};
+		if entry.pc > b.code.Len() { r.fail("invalid line table"); }
+		b.line_table.Push(entry);
+	}
+	b.covered = b.code.Len();
+	for n := r.count(); n > 0; n-- { b.defaults.Push(r.uint()); }
+	for n := r.count(); n > 0; n-- {
+		h := Handler{start: r.uint(), end: r.uint(), handler: r.uint(), reg: r.uint(), ensure: r.uint() != 0};
+		if h.start > h.end || h.end > b.code.Len() || h.handler > b.code.Len() { r.fail("invalid handler"); }
+		b.handlers.Push(h);
+	}
+	for n := r.count(); n > 0; n-- { b.sites.Push(new(TrInlineCache)); }
+	for n := r.count(); n > 0 && r.err == nil; n-- { b.blocks.Push(r.block(vm, b)); }
+	return b;
+}
+
+// Checks the header of the bytecode file data, returns its payload and the checksum of the source
+// it was compiled from.
+func Bytecode_validate(data []byte) ([]byte, uint32, error) {
+	if len(data) < TR_BYTECODE_HEADER || string(data[0:4]) != TR_BYTECODE_MAGIC {
+		return nil, 0, fmt.Errorf("not a tinyrb bytecode file");
+	}
+	if version := binary.LittleEndian.Uint16(data[4:]); version != TR_BYTECODE_VERSION {
+		return nil, 0, fmt.Errorf("bytecode version %d, expected %d", version, TR_BYTECODE_VERSION);
+	}
+	if binary.LittleEndian.Uint16(data[6:]) != uint16(len(OPCODE_NAMES)) {
+		return nil, 0, fmt.Errorf("bytecode compiled for a VM with other opcodes");
+	}
+	payload := data[TR_BYTECODE_HEADER:];
+	if int(binary.LittleEndian.Uint32(data[12:])) != len(payload) { return nil, 0, fmt.Errorf("truncated bytecode"); }
+	if binary.LittleEndian.Uint32(data[16:]) != crc32.ChecksumIEEE(payload) {
+		return nil, 0, fmt.Errorf("bytecode checksum mismatch");
+	}
+	return payload, binary.LittleEndian.Uint32(data[8:]), nil;
+}
+
+// Reads the Block tree of the bytecode file data.
+func Block_deserialize(vm *RubyVM, data []byte) (*Block, error) {
+	payload, _, err := Bytecode_validate(data);
+	if err != nil { return nil, err; }
+	r := BytecodeReader{data: payload};
+	b := r.block(vm, nil);
+	if r.err == nil && r.pos != len(payload) { r.fail("trailing bytes after bytecode"); }
+	if r.err != nil { return nil, r.err; }
+	return b, nil;
+}
+
+// The bytecode file preferred to the source file filename when it's up to date.
+func bytecode_path(filename string) string {
+	if !strings.HasSuffix(filename, ".rb") { return ""; }
+	return strings.TrimSuffix(filename, ".rb") + ".trc";
+}
+
+// Returns the Block of the bytecode file next to the source filename if it was compiled from code as
+// it is now, or nil if there is none, it's stale or it's invalid, in which case code is compiled.
+func (vm *RubyVM) fresh_bytecode(filename string, code []byte) *Block {
+	trc := bytecode_path(filename);
+	if trc == "" || !file_exists(trc) { return nil; }
+	data, err := read_file(trc);
+	if err != nil { return nil; }
+	if _, crc, err := Bytecode_validate(data); err != nil || crc != crc32.ChecksumIEEE(code) {
+		if err != nil && vm.debug > 0 { fmt.Fprintf(os.Stderr, "; ignoring %s: %s\n", trc, err); }
+		return nil;
+	}
+	block, err := Block_deserialize(vm, data);
+	if err != nil {
+		if vm.debug > 0 { fmt.Fprintf(os.Stderr, "; ignoring %s: %s\n", trc, err); }
+		return nil;
+	}
+	return block;
+}
+
+// Loads the bytecode file filename, raising a LoadError if it can't be trusted.
+func (vm *RubyVM) load_bytecode(filename string) RubyObject {
+	var block *Block;
+	data, err := read_file(filename);
+	if err == nil { block, err = Block_deserialize(vm, data); }
+	if err == nil { return vm.run_toplevel(block); }
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	vm.throw_value = TrException_new(vm, vm.cLoadError, tr_sprintf(vm, "%s: %s", filename, err));
+	return TR_UNDEF;
+}
+
+// Compiles the source file filename to the bytecode file output, by default the .trc next to it.
+func (vm *RubyVM) compile_file(filename, output string) RubyObject {
+	var data []byte;
+	code, err := read_file(filename);
+	if err == nil {
+		block := Block_compile(vm, code, filename, 0);
+		if !block { return TR_UNDEF; }
+		data, err = Block_serialize(vm, block, code);
+	}
+	if err == nil {
+		if output == "" { output = bytecode_path(filename); }
+		if output == "" { output = filename + ".trc"; }
+		err = os.WriteFile(output, data, 0644);
+	}
+	if err == nil { return TR_TRUE; }
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	vm.throw_value = TrException_new(vm, vm.cRuntimeError, tr_sprintf(vm, "can't compile %s: %s", filename, err));
+	return TR_UNDEF;
+}
@@ -0,0 +1,88 @@
+package RubyVM
+
+import (
+	"bytes";
+	"encoding/binary";
+	"os";
+	"path/filepath";
+	"strings";
+	"testing";
+)
+
+// Writes code to a .rb file in a temporary directory and compiles it like tinyrb -c does.
+// Returns the paths of the source and of the bytecode file.
+func compile_fixture(t *testing.T, code string) (string, string) {
+	dir := t.TempDir();
+	src := filepath.Join(dir, "fixture.rb");
+	if err := os.WriteFile(src, []byte(code), 0644); err != nil { t.Fatal(err); }
+	if newRubyVM().compile_file(src, "") != TR_TRUE { t.Fatalf("can't compile %s", src); }
+	return src, bytecode_path(src);
+}
+
+// Loads filename in a new VM, returns what it printed.
+func load_output(t *testing.T, filename string) string {
+	vm := newRubyVM();
+	out := new(bytes.Buffer);
+	vm.out = out;
+	if vm.load(filename) == TR_UNDEF {
+		TrException_report(vm, vm.throw_value);
+		t.Fatalf("loading %s failed: %s", filename, out.String());
+	}
+	return out.String();
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	code := "def twice(x)\n  x * 2\nend\nbegin\n  raise \"oops\"\nrescue => e\n  puts e.message\nend\nputs twice(21)\nputs 1180591620717411303424\nputs 1.5\nputs :sym\n";
+	src, trc := compile_fixture(t, code);
+	expected := "oops\n42\n1180591620717411303424\n1.5\nsym\n";
+	if out := load_output(t, trc); out != expected { t.Errorf("loading the .trc printed %q, expected %q", out, expected); }
+
+	// the source is run from its up to date .trc
+	data, err := os.ReadFile(trc);
+	if err != nil { t.Fatal(err); }
+	if newRubyVM().fresh_bytecode(src, []byte(code)) == nil { t.Errorf("%s should be used for %s", trc, src); }
+	if out := load_output(t, src); out != expected { t.Errorf("loading the source printed %q, expected %q", out, expected); }
+
+	// a block read back serializes to the same bytes
+	vm := newRubyVM();
+	block, err := Block_deserialize(vm, data);
+	if err != nil { t.Fatal(err); }
+	again, err := Block_serialize(vm, block, []byte(code));
+	if err != nil { t.Fatal(err); }
+	if !bytes.Equal(data, again) { t.Errorf("serializing a deserialized block changed the bytecode"); }
+}
+
+func expect_invalid(t *testing.T, data []byte, message string) {
+	if _, _, err := Bytecode_validate(data); err == nil || !strings.Contains(err.Error(), message) {
+		t.Errorf("expected an error containing %q, got %v", message, err);
+	}
+	if _, err := Block_deserialize(newRubyVM(), data); err == nil { t.Errorf("invalid bytecode shouldn't be read"); }
+}
+
+func TestBytecodeVersionMismatch(t *testing.T) {
+	_, trc := compile_fixture(t, "puts 1\n");
+	data, err := os.ReadFile(trc);
+	if err != nil { t.Fatal(err); }
+	binary.LittleEndian.PutUint16(data[4:], TR_BYTECODE_VERSION + 1);
+	expect_invalid(t, data, "bytecode version");
+}
+
+func TestBytecodeChecksumMismatch(t *testing.T) {
+	_, trc := compile_fixture(t, "puts 1\n");
+	data, err := os.ReadFile(trc);
+	if err != nil { t.Fatal(err); }
+	data[len(data) - 1] ^= 0xff;
+	expect_invalid(t, data, "checksum mismatch");
+	expect_invalid(t, data[0:len(data) - 1], "truncated bytecode");
+	expect_invalid(t, []byte("puts 1\n"), "not a tinyrb bytecode file");
+}
+
+func TestBytecodeStaleSource(t *testing.T) {
+	src, trc := compile_fixture(t, "puts \"compiled\"\n");
+	changed := "puts \"changed\"\n";
+	if err := os.WriteFile(src, []byte(changed), 0644); err != nil { t.Fatal(err); }
+	if newRubyVM().fresh_bytecode(src, []byte(changed)) != nil { t.Errorf("%s is stale and shouldn't be used", trc); }
+	if out := load_output(t, src); out != "changed\n" { t.Errorf("the changed source should run, printed %q", out); }
+	// loading the .trc directly still runs what it was compiled from
+	if out := load_output(t, trc); out != "compiled\n" { t.Errorf("loading the .trc printed %q", out); }
+}
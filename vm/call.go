@@ -1,9 +1,32 @@
-#include <alloca.h>
-
 import (
-	"bytes";
+	"tr";
 	)
 
+// Raises an ArgumentError unless argc is between min and max, max being -1 for no limit. Native
+// methods, methods defined in Ruby and lambdas all check their arguments this way.
+func (vm *RubyVM) check_argc(argc, min, max int) bool {
+	if argc >= min && (max < 0 || argc <= max) { return true; }
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	switch {
+		case min == max:	msg := tr_sprintf(vm, "wrong number of arguments (%d for %d)", argc, min);
+		case max < 0:		msg := tr_sprintf(vm, "wrong number of arguments (%d for %d+)", argc, min);
+		default:			msg := tr_sprintf(vm, "wrong number of arguments (%d for %d..%d)", argc, min, max);
+	}
+	vm.throw_value = TrException_new(vm, vm.cArgumentError, msg);
+	return false;
+}
+
+// Returns the args with the last one, an Array, replaced by its items.
+func splat_args(args []RubyObject) []RubyObject {
+	last := args[len(args) - 1];
+	if TR_IMMEDIATE(last) || !last.(Array) { return args; }
+	values := Array *(last).values;
+	expanded := make([]RubyObject, 0, len(args) - 1 + values.Len());
+	expanded = append(expanded, args[0:len(args) - 1]...);
+	for value := range values.Iter() { expanded = append(expanded, value); }
+	return expanded;
+}
+
 func (self *Method) call(vm *RubyVM, receiver *RubyObject, argc int, args []RubyObject, splat int, closure *Closure) RubyObject {
 	if TR_IMMEDIATE(receiver) {
 		receiver_class := vm.classes[Object_type(vm, receiver)];
@@ -16,58 +39,32 @@ func (self *Method) call(vm *RubyVM, receiver *RubyObject, argc int, args []Ruby
 	if vm.cf >= TR_MAX_FRAMES {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cSystemStackError, tr_sprintf(vm, "Stack overflow"));
+		vm.cf--;
 		return TR_UNDEF;
 	}
 
 	frame := newFrame(receiver, receiver_class, closure);
+	frame.cbase = self.cbase;
 	if vm.cf == 0 { vm.top_frame = frame; }
 	vm.frame = frame;
 	vm.throw_reason = vm.throw_value = 0;
 
 	// execute BODY inside the frame
-	method := frame.method = self;
-	function = frame.method.func;
-
-	// splat last arg is needed
-	if splat {
-		splated := args[argc - 1];
-		splatedn := splated.kv.Len();
-		new_args := make([]OBJ, argc)
-		memcpy(new_args, args, sizeof(OBJ) * (argc - 1));
-		memcpy(new_args + argc - 1, &splated.values.At(0), sizeof(OBJ) * splatedn);
-		argc += splatedn-1;
-		args = new_args;
-	}
+	frame.method = self;
+	args = args[0:argc];
+	// the splatted last arg can hold any number of args
+	if splat { args = splat_args(args); }
 
-	if (m.arity == -1) {
-		result := function(vm, receiver, argc, args);
+	if !vm.check_argc(len(args), self.min_args, self.max_args) {
+		result := TR_UNDEF;
+	} else if self.gofunc.IsValid() {
+		result := self.call_go(vm, receiver, args);
 	} else {
-		if method.arity != argc {
-			vm.throw_reason = TR_THROW_EXCEPTION;
-			vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "Expected %d arguments, got %d.", frame.method.arity, argc));
-			return TR_UNDEF;
-		}
-		switch argc {
-			case 0:  result := function(vm, receiver);
-			case 1:  result := function(vm, receiver, args[0]);
-			case 2:  result := function(vm, receiver, args[0], args[1]);
-			case 3:  result := function(vm, receiver, args[0], args[1], args[2]);
-			case 4:  result := function(vm, receiver, args[0], args[1], args[2], args[3]);
-			case 5:  result := function(vm, receiver, args[0], args[1], args[2], args[3], args[4]);
-			case 6:  result := function(vm, receiver, args[0], args[1], args[2], args[3], args[4], args[5]);
-			case 7:  result := function(vm, receiver, args[0], args[1], args[2], args[3], args[4], args[5], args[6]);
-			case 8:  result := function(vm, receiver, args[0], args[1], args[2], args[3], args[4], args[5], args[6], args[7]);
-			case 9:  result := function(vm, receiver, args[0], args[1], args[2], args[3], args[4], args[5], args[6], args[7], args[8]);
-			case 10: result := function(vm, receiver, args[0], args[1], args[2], args[3], args[4], args[5], args[6], args[7], args[8], args[9]);
-			default:
-				vm.throw_reason = TR_THROW_EXCEPTION;
-				vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "Too many arguments: %d, max is %d for now.", argc, 10));
-				return TR_UNDEF;
-		}
+		result := self.func(vm, receiver, args, closure);
 	}
 
-	// pop the frame
+	// pop the frame, an exception might be rescued by the caller
 	vm.cf--;
 	vm.frame = vm.frame.previous;
 	return result;
-}
\ No newline at end of file
+}
@@ -1,4 +1,6 @@
 import (
+	"fmt";
+	"reflect";
 	"tr";
 )
 
@@ -6,10 +8,15 @@ type Method struct {
 	type			TR_T;
 	class			*RubyObject;
 	ivars			map[string] RubyObject;
-  	func			*TrFunc;
+  	func			TrFunc;
 	data			*RubyObject;
 	name			*RubyObject;
 	arity			int;
+	min_args		int;					// args the method takes, max_args is -1 for no limit
+	max_args		int;
+	cbase			*RubyObject;			// module the method was defined in, for constant lookup
+	gofunc			reflect.Value;			// Go func called instead of func, see newGoMethod
+	go_receiver		bool;					// gofunc takes the receiver as first parameter
 }
 
 type Module struct {
@@ -19,11 +26,16 @@ type Module struct {
 	name			*RubyObject;
 	super			*RubyObject;
 	methods			map[string] RubyObject;
+	consts			map[string] RubyObject;
+	parent			*RubyObject;			// module it's lexically nested in
 	meta			bool;
+	origin			*RubyObject;			// module an included module proxy stands for in an ancestor chain
+	serial			int;					// bumped when its methods or ancestors change, expires the call sites caching them
+	subclasses		[]RubyObject;			// classes inheriting from it or including it, expired with it
 }
 
 func (vm *RubyVM) newModule(name *RubyObject) RubyObject {
-	return Module{type: TR_T_Module, class: vm.classes[TR_T_Module], ivars: make(map[string] RubyObject), name: name, methods: make(map[string] RubyObject)};
+	return Module{type: TR_T_Module, class: vm.classes[TR_T_Module], ivars: make(map[string] RubyObject), name: name, methods: make(map[string] RubyObject), consts: make(map[string] RubyObject)};
 }
 
 func (vm *RubyVM) newIncludedModule(module, super *RubyObject) RubyObject {
@@ -33,7 +45,7 @@ func (vm *RubyVM) newIncludedModule(module, super *RubyObject) RubyObject {
 		return TR_UNDEF;
 	}
 	m := Class *(module);
-	return Module{type: TR_T_Module, class: vm.classes[TR_T_Module], ivars: make(map[string] RubyObject), name: m.name, methods: m.methods, super: super};
+	return Module{type: TR_T_Module, class: vm.classes[TR_T_Module], ivars: make(map[string] RubyObject), name: m.name, methods: m.methods, consts: m.consts, super: super, origin: module};
 }
 
 type Class struct {
@@ -54,6 +66,16 @@ func (self *Module) instance_method(vm *RubyVM, name *RubyObject) RubyObject {
 	return TR_NIL;
 }
 
+// Looks up a constant in the module and its ancestors, returns TR_UNDEF if it's not found.
+func (self *Module) find_const(vm *RubyVM, name *RubyObject) RubyObject {
+	class := Class *(self);
+	while (class) {
+		if value, ok := Class *(class).consts[name]; ok { return value; }
+		class = Class *(class).super;
+	}
+	return TR_UNDEF;
+}
+
 func (self *Module) add_method(vm *RubyVM, name, method *RubyObject) RubyObject {
 	if !self.(Class) && !self.(Module) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
@@ -63,11 +85,37 @@ func (self *Module) add_method(vm *RubyVM, name, method *RubyObject) RubyObject
 	m := Class *(self);
 	m.methods[name] = method;
 	method.name = name;
+	self.expire(vm);
 	return method;
 }
 
+// Adds a copy of the method old_name under new_name, the original keeps its name for super and
+// backtraces.
 func (self *Module) alias_method(vm *RubyVM, new_name, old_name *RubyObject) RubyObject {
-	return self.instance_method(vm, old_name).add_method(vm, self, new_name);
+	method := self.instance_method(vm, old_name);
+	if method == TR_UNDEF { return TR_UNDEF; }
+	if method == TR_NIL {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cNameError, tr_sprintf(vm, "undefined method `%s' for class `%s'", old_name.ptr, Class *(self).name.ptr));
+		return TR_UNDEF;
+	}
+	alias := *(Method *(method));
+	return self.add_method(vm, new_name, &alias);
+}
+
+// Makes super the superclass of the class, which then expires along with it.
+func (self *Module) inherit(vm *RubyVM, super *RubyObject) {
+	Class *(self).super = super;
+	if super { Class *(super).subclasses = append(Class *(super).subclasses, self); }
+	self.expire(vm);
+}
+
+// Expires the call sites caching methods looked up on the module or on the classes inheriting
+// from it or including it.
+func (self *Module) expire(vm *RubyVM) {
+	m := Class *(self);
+	m.serial++;
+	for _, sub := range m.subclasses { Module *(sub).expire(vm); }
 }
 
 func (self *Module) include(vm *RubyVM, module *RubyObject) RubyObject {
@@ -78,6 +126,9 @@ func (self *Module) include(vm *RubyVM, module *RubyObject) RubyObject {
 	}
 	class := Class *(self);
 	class.super = vm.newIncludedModule(module, class.super);
+	// methods added to the module later expire the class too
+	Class *(module).subclasses = append(Class *(module).subclasses, self);
+	self.expire(vm);
 	return module;
 }
 
@@ -90,19 +141,145 @@ func (self *Module) name(vm *RubyVM) RubyObject {
 	return Class *(self).name;
 }
 
+// Converts a constant name passed as a String or Symbol to a Symbol.
+func const_name(vm *RubyVM, name *RubyObject) RubyObject {
+	if name.(String) { return TrSymbol_new(vm, name.ptr); }
+	if !name.(Symbol) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "%s is not a symbol", Object_inspect(vm, name).ptr));
+		return TR_UNDEF;
+	}
+	return name;
+}
+
+func (self *Module) const_get(vm *RubyVM, name *RubyObject) RubyObject {
+	if !self.(Class) && !self.(Module) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "%s is not a class/module", Object_inspect(vm, self).ptr));
+		return TR_UNDEF;
+	}
+	if RubyObject(name = const_name(vm, name)) == TR_UNDEF { return TR_UNDEF; }
+	if value := self.find_const(vm, name); value != TR_UNDEF { return value; }
+	// modules don't inherit from Object but still see top level constants
+	if value, ok := vm.consts[name]; ok { return value; }
+	return Object_send(vm, self, 2, { TrSymbol_new(vm, "const_missing"), name });
+}
+
+func (self *Module) const_set(vm *RubyVM, name, value *RubyObject) RubyObject {
+	if RubyObject(name = const_name(vm, name)) == TR_UNDEF { return TR_UNDEF; }
+	return Object_const_set(vm, self, name, value);
+}
+
+func (self *Module) const_defined(vm *RubyVM, name *RubyObject) RubyObject {
+	if !self.(Class) && !self.(Module) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
+		return TR_UNDEF;
+	}
+	if RubyObject(name = const_name(vm, name)) == TR_UNDEF { return TR_UNDEF; }
+	if self.find_const(vm, name) != TR_UNDEF { return TR_TRUE; }
+	return TR_FALSE;
+}
+
+// Returns the names of the constants in the module and its ancestors, except those of Object
+// which every class inherits.
+func (self *Module) constants(vm *RubyVM) RubyObject {
+	if !self.(Class) && !self.(Module) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
+		return TR_UNDEF;
+	}
+	names := vm.newArray();
+	seen := make(map[string] bool);
+	class := Class *(self);
+	while (class) {
+		if class != self && class == vm.classes[TR_T_Object] { break; }
+		for name := range Class *(class).consts {
+			if !seen[name] {
+				seen[name] = true;
+				names.Push(name);
+			}
+		}
+		class = Class *(class).super;
+	}
+	return names;
+}
+
+// Called when a constant can't be found in the module, raises NameError.
+func (self *Module) const_missing(vm *RubyVM, name *RubyObject) RubyObject {
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	if self == vm.classes[TR_T_Object] {
+		vm.throw_value = TrException_new(vm, vm.cNameError, tr_sprintf(vm, "uninitialized constant %s", name.ptr));
+	} else {
+		vm.throw_value = TrException_new(vm, vm.cNameError, tr_sprintf(vm, "uninitialized constant %s::%s", Class *(self).name.ptr, name.ptr));
+	}
+	return TR_UNDEF;
+}
+
+// Used by case/when, true if obj is an instance of the module or one of its descendants.
+func (self *Module) eqq(vm *RubyVM, obj *RubyObject) RubyObject {
+	return Object_kind_of(vm, obj, self);
+}
+
+func TrModule_name(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).name(vm);
+}
+
+func TrModule_include(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).include(vm, args[0]);
+}
+
+func TrModule_instance_method(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).instance_method(vm, args[0]);
+}
+
+func TrModule_alias_method(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).alias_method(vm, args[0], args[1]);
+}
+
+func TrModule_const_get(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).const_get(vm, args[0]);
+}
+
+func TrModule_const_set(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).const_set(vm, args[0], args[1]);
+}
+
+func TrModule_const_defined(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).const_defined(vm, args[0]);
+}
+
+func TrModule_constants(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).constants(vm);
+}
+
+func TrModule_const_missing(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).const_missing(vm, args[0]);
+}
+
+func TrModule_eqq(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Module *(self).eqq(vm, args[0]);
+}
+
 func TrModule_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Module] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Module), newClass(vm, TrSymbol_new(vm, Module), vm.classes[TR_T_Object]));
-	c.add_method(vm, TrSymbol_new(vm, "name"), newMethod(vm, (TrFunc *)TrModule_name, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "include"), newMethod(vm, (TrFunc *)TrModule_include, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "instance_method"), newMethod(vm, (TrFunc *)TrModule_instance_method, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "alias_method"), newMethod(vm, (TrFunc *)TrModule_instance_method, TR_NIL, 2));
-	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, (TrFunc *)TrModule_name, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "name"), newMethod(vm, TrModule_name, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "include"), newMethod(vm, TrModule_include, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "instance_method"), newMethod(vm, TrModule_instance_method, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "alias_method"), newMethod(vm, TrModule_alias_method, TR_NIL, 2));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrModule_name, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "const_get"), newMethod(vm, TrModule_const_get, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "const_set"), newMethod(vm, TrModule_const_set, TR_NIL, 2));
+	c.add_method(vm, TrSymbol_new(vm, "const_defined?"), newMethod(vm, TrModule_const_defined, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "constants"), newMethod(vm, TrModule_constants, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "const_missing"), newMethod(vm, TrModule_const_missing, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "==="), newMethod(vm, TrModule_eqq, TR_NIL, 1));
 }
 
 /* class */
 
 func newClass(vm *RubyVM, name, super *RubyObject) RubyObject {
-	c := Class{type: TR_T_Class, class: vm.classes[TR_T_Class], ivars: make(map[string] RubyObject), name: name, methods: make(map[string] RubyObject), meta: false};
+	c := Class{type: TR_T_Class, class: vm.classes[TR_T_Class], ivars: make(map[string] RubyObject), name: name, methods: make(map[string] RubyObject), consts: make(map[string] RubyObject), meta: false};
 	if !super.(Class) && !super.(Module) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + super));
@@ -110,7 +287,7 @@ func newClass(vm *RubyVM, name, super *RubyObject) RubyObject {
 	}
  	// if VM is booting, those might not be set
 	if (super && Class *(super).class) { c.class = newMetaClass(vm, Class *(super).class); }
-	c.super = super
+	c.inherit(vm, super);
 	return c;
 }
 
@@ -136,10 +313,18 @@ func (self *Class) superclass(vm *RubyVM) RubyObject {
 	return super;
 }
 
+func TrClass_superclass(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Class *(self).superclass(vm);
+}
+
+func TrClass_allocate(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Class *(self).allocate(vm);
+}
+
 func TrClass_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Class] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Class), newClass(vm, TrSymbol_new(vm, Class), vm.classes[TR_T_Module]));
-	c.add_method(vm, TrSymbol_new(vm, "superclass"), newMethod(vm, (TrFunc *)TrClass_superclass, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "allocate"), newMethod(vm, (TrFunc *)TrClass_allocate, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "superclass"), newMethod(vm, TrClass_superclass, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "allocate"), newMethod(vm, TrClass_allocate, TR_NIL, 0));
 }
 
 /* metaclass */
@@ -164,15 +349,23 @@ func newMetaClass(vm *RubyVM, super *RubyObject) RubyObject {
 	}
 	name := TrSymbol_new(vm, name.ptr); /* symbolize */
 	mc = newClass(vm, name, 0);
-	mc.super = super;
+	mc.inherit(vm, super);
 	mc.meta = 1;
 	return mc;
 }
 
 /* method */
 
-func newMethod(vm *RubyVM, function *TrFunc, data *RubyObject, arity int) RubyObject {
-	return Method{type: TR_T_Method, class: vm.classes[TR_T_Method], ivars: make(map[string] RubyObject), func: function, data: data, arity: arity};
+// Returns a method calling function. arity is like the one of Method#arity: the number of args, or
+// if negative, -1 - the number of required ones, with any number of others.
+func newMethod(vm *RubyVM, function TrFunc, data *RubyObject, arity int) RubyObject {
+	m := Method{type: TR_T_Method, class: vm.classes[TR_T_Method], ivars: make(map[string] RubyObject), func: function, data: data, arity: arity};
+	if arity >= 0 {
+		m.min_args, m.max_args = arity, arity;
+	} else {
+		m.min_args, m.max_args = -1 - arity, -1;
+	}
+	return m;
 }
 
 func (self *Method) name(vm *RubyVM) RubyObject { return ((Method *) self).name; }
@@ -185,18 +378,60 @@ func (self *Method) dump(vm *RubyVM) RubyObject {
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + m.name));
 		return TR_UNDEF;
 	}
-	if m.name { println("<Method '%s':%p>", m.name.ptr, m); }
+	if m.name { fmt.Printf("<Method '%s':%p>\n", m.name.ptr, m); }
 	if m.data {
 		Block *(m.data).dump(vm, 0);
 	} else {
-		fmt.Println("<CFunction:%p>", m.func);
+		fmt.Printf("<CFunction:%p>\n", m.func);
 	}
 	return TR_NIL;
 }
 
+// Returns the bytecode listing of a method defined in Ruby as :text, the default, or :json, nil
+// for a native method.
+func (self *Method) disassemble(vm *RubyVM, argc int, argv []RubyObject) RubyObject {
+	m := (Method *) self;
+	json := argc > 0 && argv[0] == TrSymbol_new(vm, "json");
+	if argc > 0 && !json && argv[0] != TrSymbol_new(vm, "text") {
+		if !TR_IMMEDIATE(argv[0]) && argv[0].(Symbol) {
+			format := tr_sprintf(vm, ":%s", argv[0].ptr);
+		} else {
+			format := Object_send(vm, argv[0], 1, { TrSymbol_new(vm, "inspect") });
+			if format == TR_UNDEF { return TR_UNDEF; }
+		}
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "unknown format %s, expected :text or :json", format.ptr));
+		return TR_UNDEF;
+	}
+	if !m.data { return TR_NIL; }
+	listing := Block_disassemble(vm, Block *(m.data));
+	if json { return TrString_new2(vm, listing.JSON()); }
+	return TrString_new2(vm, listing.Text());
+}
+
+func TrMethod_name(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Method *(self).name(vm);
+}
+
+func TrMethod_arity(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Method *(self).arity(vm);
+}
+
+func TrMethod_dump(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Method *(self).dump(vm);
+}
+
+func TrMethod_disassemble(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Method *(self).disassemble(vm, len(args), args);
+}
+
 func TrMethod_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Method] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Method), newClass(vm, TrSymbol_new(vm, Method), vm.classes[TR_T_Object]));
-	c.add_method(vm, TrSymbol_new(vm, "name"), newMethod(vm, (TrFunc *)TrMethod_name, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "arity"), newMethod(vm, (TrFunc *)TrMethod_arity, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "dump"), newMethod(vm, (TrFunc *)TrMethod_dump, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "name"), newMethod(vm, TrMethod_name, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "arity"), newMethod(vm, TrMethod_arity, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "dump"), newMethod(vm, TrMethod_dump, TR_NIL, 0));
+	disassemble := newMethod(vm, TrMethod_disassemble, TR_NIL, -1);
+	// an optional format
+	disassemble.min_args, disassemble.max_args = 0, 1;
+	c.add_method(vm, TrSymbol_new(vm, "disassemble"), disassemble);
 }
\ No newline at end of file
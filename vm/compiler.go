@@ -1,6 +1,7 @@
 import (
 	"tr";
 	"opcode";
+	"container/vector";
 )
 
 // ast node
@@ -11,6 +12,7 @@ type ASTNode struct {
 	ntype		int;
 	args		[3]RubyObject;
 	line		size_t;
+	column		int;			// 0 when unknown
 }
 
 // types of nodes in the AST built by the parser
@@ -55,16 +57,62 @@ const (
 	NODE_ADD;
 	NODE_SUB;
 	NODE_LT;
+	NODE_MUL;
+	NODE_DIV;
+	NODE_MOD;
+	NODE_EQ;
+	NODE_LE;
+	NODE_GT;
+	NODE_GE;
 	NODE_NEG;
 	NODE_NOT;
+	NODE_BEGIN;
+	NODE_RESCUE;
+	NODE_ENSURE;
+	NODE_SUPER;
+	NODE_CASE;
+	NODE_WHEN;
+	NODE_DSTR;
+	NODE_OPASGN;
+	NODE_MASGN;
+	NODE_NEXT;
 )
 
 func newASTNode(vm *RubyVM, type int, a, b, c *RubyObject, line size_t) RubyObject {
 	return ASTNode{ntype: type, type: TR_T_NODE, args: {a, b, c}, line: line}
 }
 
+// The grammar passes source positions around packed in a Fixnum, columns are capped at TR_COLUMN_MAX.
+const TR_COLUMN_MAX = 0x3ff;
+
+func newPosition(line, column int) RubyObject {
+	if column > TR_COLUMN_MAX { column = TR_COLUMN_MAX; }
+	return TR_INT2FIX(line << 10 | column);
+}
+
+// Moves node to the position where its source starts.
+func set_position(node, pos *RubyObject) {
+	if !node || !node.(ASTNode) { return; }
+	node.line = TR_FIX2INT(pos) >> 10;
+	node.column = TR_FIX2INT(pos) & TR_COLUMN_MAX;
+}
+
+// Node of the binary operator op when it has its own instruction, NODE_SEND for the others.
+func operator_node(vm *RubyVM, op *RubyObject) int {
+	switch op {
+		case TrSymbol_new(vm, "+"):	return NODE_ADD;
+		case TrSymbol_new(vm, "-"):	return NODE_SUB;
+		case TrSymbol_new(vm, "*"):	return NODE_MUL;
+		case TrSymbol_new(vm, "/"):	return NODE_DIV;
+		case TrSymbol_new(vm, "%"):	return NODE_MOD;
+	}
+	return NODE_SEND;
+}
+
 type Compiler struct {
 	line		int;
+	line_start	int;			// offset in the input of the start of the current line
+	eof			bool;			// the parser read the input to its end
 	filename	*RubyObject;
 	vm			*RubyVM;
   	block		*Block;
@@ -104,6 +152,90 @@ func (self *ASTNode) compile_to_RK(vm *RubyVM, c *Compiler, b *Block, reg int) i
 	}
 }
 
+// Pushes the locals assigned by the multiple assignment self that aren't defined yet.
+func (self *ASTNode) declare_targets(b *Block) {
+	for item := range self.args[0].Iter() {
+		target := item.args[0];
+		switch target.ntype {
+			case NODE_ASSIGN:
+				name := target.args[0];
+				if b.find_local(name) == -1 && b.find_upval_in_scope(name) == -1 { b.push_local(name); }
+			case NODE_MASGN:
+				target.declare_targets(b);
+		}
+	}
+}
+
+// Declares the locals node assigns before it's compiled, so they don't get the registers the code
+// around it keeps using, like the one of a loop. Blocks, methods and classes have their own.
+func (self *ASTNode) declare_locals(b *Block) {
+	switch self.ntype {
+		case NODE_BLOCK, NODE_DEF, NODE_CLASS, NODE_MODULE:
+			return;
+		case NODE_ASSIGN, NODE_RESCUE:
+			name := self.args[0];
+			if self.ntype == NODE_RESCUE { name = self.args[1]; }
+			if name && b.find_local(name) == -1 && b.find_upval_in_scope(name) == -1 { b.push_local(name); }
+		case NODE_MASGN:
+			self.declare_targets(b);
+	}
+	for _, arg := range self.args {
+		if !arg || TR_IMMEDIATE(arg) { continue; }
+		if arg.(ASTNode) {
+			arg.declare_locals(b);
+		} else if arg.(Array) {
+			for item := range arg.Iter() {
+				if item && !TR_IMMEDIATE(item) && item.(ASTNode) { item.declare_locals(b); }
+			}
+		}
+	}
+}
+
+// Spreads R[base] over R[base+1..] for the targets of the multiple assignment self.
+func (self *ASTNode) compile_unpack(b *Block, base int) {
+	count := self.args[0].kv.Len();
+	splat := 0;
+	for n := 0; n < count; n++ {
+		if self.args[0].kv.At(n).args[1] { splat = n + 1; }
+	}
+	if base + count >= b.regc { b.regc = base + count + 1; }
+	b.code.Push(MachineOp{OpCode: TR_OP_UNPACK, A: base, B: count, C: splat});
+}
+
+// Assigns R[base+1..] to the targets of the multiple assignment self, nested ones are unpacked above them.
+func (self *ASTNode) compile_targets(vm *RubyVM, c *Compiler, b *Block, base int) {
+	count := self.args[0].kv.Len();
+	n := 0;
+	for item := range self.args[0].Iter() {
+		src := base + 1 + n;
+		target := item.args[0];
+		switch target.ntype {
+			case NODE_ASSIGN:
+				name := target.args[0];
+				if (i := b.find_local(name)) != -1 {
+					if i != src { b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: i, B: src}); }
+				} else {
+					b.code.Push(MachineOp{OpCode: TR_OP_SETUPVAL, A: src, B: b.push_upval(name)});
+				}
+			case NODE_SETIVAR:
+				b.code.Push(newExtendedOP(TR_OP_SETIVAR, src, b.push_value(target.args[0])));
+			case NODE_SETCVAR:
+				b.code.Push(newExtendedOP(TR_OP_SETCVAR, src, b.push_value(target.args[0])));
+			case NODE_SETGLOBAL:
+				b.code.Push(newExtendedOP(TR_OP_SETGLOBAL, src, b.push_value(target.args[0])));
+			case NODE_MASGN:
+				scratch := base + count + 1;
+				if scratch >= b.regc { b.regc = scratch + 1; }
+				b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: scratch, B: src});
+				target.compile_unpack(b, scratch);
+				target.compile_targets(vm, c, b, scratch);
+			default:
+				assert(0);
+		}
+		n++;
+	}
+}
+
 func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObject {
 	if !self { return TR_NIL; }
 	start_reg := reg;
@@ -131,6 +263,37 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 			}
 			b.code.Push(newExtendedOP(TR_OP_STRING, reg, b.push_string(self.args[0].ptr));
 
+		case NODE_DSTR:
+			parts := self.args[0];
+			if parts.kv.Len() == 0 || (parts.kv.Len() == 1 && parts.kv.At(0).ntype == NODE_STRING) {
+				// nothing to interpolate
+				str := TrString_new2(vm, "");
+				if parts.kv.Len() { str = parts.kv.At(0).args[0]; }
+				if self.args[1] {
+					b.code.Push(newExtendedOP(TR_OP_LOADK, reg, b.push_value(TrRegexp_new(vm, str.ptr, 0))));
+				} else {
+					b.code.Push(newExtendedOP(TR_OP_STRING, reg, b.push_string(str.ptr)));
+				}
+			} else {
+				// each part in its own register, joined in R[reg]
+				index := 0;
+				for part := range parts.Iter() {
+					nlocal := b.locals.Len();
+					new_reg := reg + index;
+					if new_reg >= b.regc { b.regc = new_reg + 1; }
+					part.compile(vm, c, b, new_reg);
+					reg += b.locals.Len() - nlocal;
+					if reg >= b.regc { b.regc = reg + 1; }
+					index++;
+				}
+				if start_reg != reg {
+					vm.throw_reason = TR_THROW_EXCEPTION;
+					vm.throw_value = TrException_new(vm, vm.cSyntaxError, tr_sprintf(vm, "Can't create local variable inside String"));
+					return TR_UNDEF;
+				}
+				b.code.Push(MachineOp{OpCode: TR_OP_DSTR, A: reg, B: parts.kv.Len(), C: self.args[1]});
+			}
+
 		case NODE_ARRAY:
 			size := 0;
 			if self.args[0] {
@@ -193,8 +356,11 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 
 		case NODE_ASSIGN:
 			name := self.args[0];
+			nlocal := b.locals.Len();
 			if reg >= b.regc { b.regc = reg + 1; }
 			self.args[1].compile(vm, c, b, reg);
+			// a value declaring locals, like a loop, is left after them
+			reg += b.locals.Len() - nlocal;
 			if (b.find_upval_in_scope(name) != -1) {
 				// upval
 				b.code.Push(MachineOp{OpCode: TR_OP_SETUPVAL, A: reg, B: b.push_upval(name)});
@@ -213,6 +379,140 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 				}
 			}
 
+		case NODE_MASGN:
+			// a, b = 1, 2
+			//   R[base+1..] = values, moved to the targets
+			//   R[base] = Array of the values
+			// a, *b = 1, 2 or a, b = ary
+			//   R[base] = Array of the values or ary
+			//   R[base+1..] = unpacked R[base], moved to the targets
+			// base is after the locals the assignment defines
+			lhs := self.args[0];
+			rhs := self.args[1];
+			nlocal := b.locals.Len();
+			self.declare_targets(b);
+			base := reg + b.locals.Len() - nlocal;
+			count := lhs.kv.Len();
+			splat := false;
+			for item := range lhs.Iter() { if item.args[1] { splat = true; } }
+			if rhs.kv.Len() == 1 {
+				if base >= b.regc { b.regc = base + 1; }
+				rhs.kv.At(0).compile(vm, c, b, base);
+				self.compile_unpack(b, base);
+			} else {
+				start_base := base;
+				index := 0;
+				for value := range rhs.Iter() {
+					nlocal := b.locals.Len();
+					new_reg := base + 1 + index;
+					if new_reg >= b.regc { b.regc = new_reg + 1; }
+					value.compile(vm, c, b, new_reg);
+					base += b.locals.Len() - nlocal;
+					index++;
+				}
+				if start_base != base {
+					vm.throw_reason = TR_THROW_EXCEPTION;
+					vm.throw_value = TrException_new(vm, vm.cSyntaxError, tr_sprintf(vm, "Can't create local variable inside multiple assignment"));
+					return TR_UNDEF;
+				}
+				b.code.Push(MachineOp{OpCode: TR_OP_NEWARRAY, A: base, B: rhs.kv.Len()});
+				if splat {
+					self.compile_unpack(b, base);
+				} else {
+					// missing values are nil
+					for ; index < count; index++ {
+						if base + 1 + index >= b.regc { b.regc = base + 2 + index; }
+						b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: base + 1 + index});
+					}
+				}
+			}
+			self.compile_targets(vm, c, b, base);
+
+		case NODE_OPASGN: {
+			target := self.args[0];
+			op := self.args[1];
+			value := self.args[2];
+			if target.ntype == NODE_SEND && (target.args[0] || target.args[1].args[1]) {
+				// obj.attr op= value or obj[args] op= value
+				//   R[reg+1] = obj, R[reg+2..] = args, evaluated once
+				//   R[reg] = R[call] = obj.attr or obj[args]
+				//   jmpif or jmpunless R[reg] end     <- ||= and &&=
+				//   R[reg] = value or R[reg] op value
+				//   obj.attr=(R[reg]) or obj[args]=(R[reg])
+				// end:
+				msg := target.args[1];
+				argc := 0;
+				if msg.args[1] { argc = msg.args[1].kv.Len(); }
+				call := reg + argc + 2;
+				if call + argc + 2 >= b.regc { b.regc = call + argc + 3; }
+				if target.args[0] {
+					target.args[0].compile(vm, c, b, reg + 1);
+				} else {
+					b.code.Push(MachineOp{OpCode: TR_OP_SELF, A: reg + 1});
+				}
+				for n := 0; n < argc; n++ { msg.args[1].kv.At(n).args[0].compile(vm, c, b, reg + 2 + n); }
+				b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: call, B: reg + 1});
+				for n := 0; n < argc; n++ { b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: call + 2 + n, B: reg + 2 + n}); }
+				b.push_send(call, msg.args[0], argc);
+				b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: reg, B: call});
+
+				jmp := -1;
+				if op == TrSymbol_new(vm, "||") || op == TrSymbol_new(vm, "&&") {
+					if op == TrSymbol_new(vm, "||") {
+						b.code.Push(MachineOp{OpCode: TR_OP_JMPIF, A: reg});
+					} else {
+						b.code.Push(MachineOp{OpCode: TR_OP_JMPUNLESS, A: reg});
+					}
+					jmp = b.code.Len() - 1;
+					value.compile(vm, c, b, reg);
+				} else {
+					value.compile(vm, c, b, call + 2);
+					b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: call, B: reg});
+					b.push_send(call, op, 1);
+					b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: reg, B: call});
+				}
+
+				b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: call, B: reg + 1});
+				for n := 0; n < argc; n++ { b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: call + 2 + n, B: reg + 2 + n}); }
+				b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: call + 2 + argc, B: reg});
+				b.push_send(call, TrSymbol_new(vm, tr_sprintf(vm, "%s=", msg.args[0].ptr).ptr), argc + 1);
+				if jmp != -1 { b.code.At(jmp).Set_sBx(b.code.Len() - jmp - 1); }
+
+			} else {
+				// variables are rewritten as var = var op value, var || var = value or var && var = value
+				name := target.args[0];
+				setter := NODE_ASSIGN;
+				switch target.ntype {
+					case NODE_SEND:
+						name = target.args[1].args[0];
+						if b.find_local(name) == -1 && b.find_upval_in_scope(name) == -1 {
+							// the variable is defined, to nil, by the assignment
+							b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: b.push_local(name)});
+						}
+					case NODE_GETIVAR:		setter = NODE_SETIVAR;
+					case NODE_GETCVAR:		setter = NODE_SETCVAR;
+					case NODE_GETGLOBAL:	setter = NODE_SETGLOBAL;
+					default:				assert(0);
+				}
+				node := nil;
+				switch op {
+					case TrSymbol_new(vm, "||"):
+						node = newASTNode(vm, NODE_OR, target, newASTNode(vm, setter, name, value, 0, self.line), 0, self.line);
+					case TrSymbol_new(vm, "&&"):
+						node = newASTNode(vm, NODE_AND, target, newASTNode(vm, setter, name, value, 0, self.line), 0, self.line);
+					default:
+						combined := nil;
+						if ntype := operator_node(vm, op); ntype != NODE_SEND {
+							combined = newASTNode(vm, ntype, target, value, 0, self.line);
+						} else {
+							combined = newASTNode(vm, NODE_SEND, target, newASTNode(vm, NODE_MSG, op, vm.newArray2(1, newASTNode(vm, NODE_ARG, value, 0, 0, self.line)), 0, self.line), 0, self.line);
+						}
+						node = newASTNode(vm, setter, name, combined, 0, self.line);
+				}
+				node.compile(vm, c, b, reg);
+			}
+		}
+
 		case NODE_SETIVAR:
 			if reg >= b.regc { b.regc = reg + 1; }
 			self.args[1].compile(vm, c, b, reg);
@@ -237,17 +537,29 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 		case NODE_GETGLOBAL:
 			b.code.Push(newExtendedOP(TR_OP_GETGLOBAL, reg, b.push_value(self.args[0])));
 
-		case NODE_SEND:
+		case NODE_SEND, NODE_SUPER:
 			// can also be a variable access
 			msg := self.args[1];
 			name = msg.args[0];
 			assert(msg.ntype == NODE_MSG);
-			// local
-			if (i := b.find_local(name)) != -1 {
+			// super w/o args or parens passes the args of the current method
+			if self.ntype == NODE_SUPER && !msg.args[1] {
+				mb := b;
+				while (mb.parent) { mb = mb.parent; }
+				msg.args[1] = vm.newArray();
+				for n := 0; n < mb.argc; n++ {
+					param := newASTNode(vm, NODE_SEND, 0, newASTNode(vm, NODE_MSG, mb.locals.At(n), 0, 0, self.line), 0, self.line);
+					splat := 0;
+					if mb.arg_splat && n == mb.argc - 1 { splat = 1; }
+					msg.args[1].Push(newASTNode(vm, NODE_ARG, param, splat, 0, self.line));
+				}
+			}
+			// local, super is never a variable
+			if self.ntype != NODE_SUPER && (i := b.find_local(name)) != -1 {
 				if reg != i { b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: reg, B: i}); }
 
 			// upval
-			} else if b.find_upval_in_scope(name) != -1 {
+			} else if self.ntype != NODE_SUPER && b.find_upval_in_scope(name) != -1 {
 				b.code.Push(MachineOp{OpCode: TR_OP_GETUPVAL, A: reg, B: b.push_upval(name)});
 
 			// method call
@@ -262,8 +574,8 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 				i = b.push_value(name);
 				// args
 				argc := 0;
+				block_pass := false;
 				if msg.args[1] {
-					argc = msg.args[1].kv.Len() << 1;
 					index := 0;
 					for argument := range msg.args[1].Iter() {
 						nlocal := b.locals.Len();
@@ -272,6 +584,11 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 						argument.args[0].compile(vm, c, b, new_reg);
 						reg += b.locals.Len() - nlocal;
 						if argument.args[1] { argc |= 1 }		// splat
+						if argument.args[2] {
+							block_pass = true;					// &blk, always last
+						} else {
+							argc += 2;
+						}
 						index++;
 					}
 					if start_reg != reg {
@@ -279,6 +596,12 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 						vm.throw_value = TrException_new(vm, vm.cSyntaxError, tr_sprintf(vm, "Can't create local variable inside arguments"));
 						return TR_UNDEF;
 					}
+					// CALL has B>>1 for the number of args
+					if argc >> 1 >= 1 << (SIZE_B - 1) {
+						vm.throw_reason = TR_THROW_EXCEPTION;
+						vm.throw_value = TrException_new(vm, vm.cSyntaxError, tr_sprintf(vm, "Too many arguments (%d), at most %d can be passed", argc >> 1, (1 << (SIZE_B - 1)) - 1));
+						return TR_UNDEF;
+					}
 				}
 
 				// block
@@ -292,18 +615,46 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 					if blkn.args[1] {
 						blk.argc = blkn.args[1].kv.Len();
 						// add parameters as locals in block context
-						for parameter := range blk.args[1].Iter() {
-							blk.push_local(parameter.args[0])
+						for parameter := range blkn.args[1].Iter() {
+							if parameter.args[1] == 3 {
+								// |(a, b)| is passed in a hidden local
+								blk.push_local(TrSymbol_new(vm, tr_sprintf(vm, "(%d)", blk.locals.Len()).ptr));
+							} else {
+								blk.push_local(parameter.args[0]);
+							}
+							if parameter.args[1] == 1 { blk.arg_splat = 1; }
+						}
+						for parameter := range blkn.args[1].Iter() {
+							if parameter.args[1] == 3 { parameter.args[2].declare_targets(blk); }
 						}
 					}
 					b.blocks.Push(blk);
 					blk_reg := blk.locals.Len();
 					if blk_reg >= b.regc { b.regc = blk_reg + 1; }
+					if blkn.args[1] {
+						// destructure the hidden locals into the names they list
+						n := 0;
+						for parameter := range blkn.args[1].Iter() {
+							if parameter.args[1] == 3 {
+								if blk_reg >= blk.regc { blk.regc = blk_reg + 1; }
+								blk.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: blk_reg, B: n});
+								parameter.args[2].compile_unpack(blk, blk_reg);
+								parameter.args[2].compile_targets(vm, c, blk, blk_reg);
+							}
+							n++;
+						}
+					}
 					blkn.compile(vm, c, blk, blk_reg);
 					blk.code.Push(MachineOp{OpCode: TR_OP_RETURN, A: blk_reg});
 				}
-				b.code.Push(MachineOp{OpCode: TR_OP_BOING});
-				b.code.Push(newExtendedOP(TR_OP_LOOKUP, reg, i));
+				b.sites.Push(new(TrInlineCache));
+				if self.ntype == NODE_SUPER {
+					b.code.Push(newExtendedOP(TR_OP_SUPER, reg, b.sites.Len() - 1));
+				} else {
+					b.code.Push(newExtendedOP(TR_OP_CACHE, reg, b.sites.Len() - 1));
+					b.code.Push(newExtendedOP(TR_OP_LOOKUP, reg, i));
+				}
+				if block_pass && !blk { blki = TR_CALL_BLOCK_PASS; }
 				b.code.Push(MachineOp{OpCode: TR_OP_CALL, A: reg, B: argc, C: blki});
 
 				// if passed block has upvalues generate one pseudo-instructions for each (A reg is ignored).
@@ -358,7 +709,78 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 			}
 			b.code.At(jmp).Set_sBx(b.code.Len() - jmp - 1);
 
+		case NODE_CASE:
+			// R[reg] = subject
+			// each when value:
+			//   R[reg+1] = value.===(R[reg])  <- or just value w/o a subject
+			//   jmpif R[reg+1] body
+			// jmp next when
+			// body:
+			//   when body
+			//   jmp end
+			// else body or nil
+			// end:
+			subject := reg;
+			if self.args[0] {
+				if reg >= b.regc { b.regc = reg + 1; }
+				self.args[0].compile(vm, c, b, reg);
+			}
+			jmps := Vector.New(0);
+			for clause := range self.args[1].Iter() {
+				matches := Vector.New(0);
+				for value := range clause.args[0].Iter() {
+					if reg + 3 >= b.regc { b.regc = reg + 4; }
+					value.compile(vm, c, b, reg + 1);
+					if self.args[0] {
+						b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: reg + 3, B: subject});
+						b.push_send(reg + 1, TrSymbol_new(vm, "==="), 1);
+					}
+					b.code.Push(MachineOp{OpCode: TR_OP_JMPIF, A: reg + 1});
+					matches.Push(b.code.Len() - 1);
+				}
+				b.code.Push(MachineOp{OpCode: TR_OP_JMP});
+				next := b.code.Len() - 1;
+				for jmp := range matches.Iter() { b.code.At(jmp).Set_sBx(b.code.Len() - jmp - 1); }
+
+				// body
+				if clause.args[1].kv.Len() == 0 {
+					b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: reg});
+				}
+				for node := range clause.args[1].Iter() {
+					nlocal := b.locals.Len();
+					if reg >= b.regc { b.regc = reg + 1; }
+					node.compile(vm, c, b, reg);
+					reg += b.locals.Len() - nlocal;
+					if reg >= b.regc { b.regc = reg + 1; }
+				}
+				b.code.Push(MachineOp{OpCode: TR_OP_JMP});
+				jmps.Push(b.code.Len() - 1);
+				b.code.At(next).Set_sBx(b.code.Len() - next - 1);
+			}
+
+			// else body
+			if self.args[2] {
+				for node := range self.args[2].Iter() {
+					nlocal := b.locals.Len();
+					if reg >= b.regc { b.regc = reg + 1; }
+					node.compile(vm, c, b, reg);
+					reg += b.locals.Len() - nlocal;
+					if reg >= b.regc { b.regc = reg + 1; }
+				}
+			} else {
+				// no when matched and no else, nil is returned
+				b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: reg});
+			}
+			for jmp := range jmps.Iter() { b.code.At(jmp).Set_sBx(b.code.Len() - jmp - 1); }
+
 		case NODE_WHILE, NODE_UNTIL:
+			// the condition and the value of the loop go after the locals of the body, where the
+			// statements around continue
+			nlocal := b.locals.Len();
+			self.declare_locals(b);
+			reg += b.locals.Len() - nlocal;
+			loop := &Loop{reg: reg, start: b.code.Len(), breaks: Vector.New(0), ensure: b.ensure, outer: b.loop};
+			b.loop = loop;
 			jmp_beg := b.code.Len();
 			// condition
 			if reg >= b.regc { b.regc = reg + 1; }
@@ -382,6 +804,10 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 		  	i := newExtendedOP(TR_OP_JMP, 0, 0);
 		  	i.SetxBx(jmp_beg - (b.code.Len() + 1));
 		  	b.code.Push(i);
+			// a loop ending on its condition is nil, one left by break has the value of the break
+			b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: loop.reg});
+			for jmp := range loop.breaks.Iter() { b.code.At(jmp).Set_sBx(b.code.Len() - jmp - 1); }
+			b.loop = loop.outer;
 
 		case NODE_AND, NODE_OR:
 			// receiver
@@ -415,14 +841,47 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 				if reg >= b.regc { b.regc = reg + 1; }
 				self.args[0].compile(vm, c, b, reg);
 			}
-			if b.parent {
+			// inside an ensure clause the return is thrown so the ensure handler runs
+			if b.parent || b.ensure > 0 {
 				b.code.Push(MachineOp{OpCode: TR_OP_THROW, A: TR_THROW_RETURN, B: reg});
 			} else {
 				b.code.Push(MachineOp{OpCode: TR_OP_RETURN, A: reg});
 			}
 
-		case NODE_BREAK:
-			b.code.Push(MachineOp{OpCode: TR_OP_THROW, A: TR_THROW_BREAK});
+		case NODE_BREAK, NODE_NEXT:
+			if self.args[0] {
+				if reg >= b.regc { b.regc = reg + 1; }
+				self.args[0].compile(vm, c, b, reg);
+			} else {
+				b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: reg});
+			}
+			keyword := "break";
+			if self.ntype == NODE_NEXT { keyword = "next"; }
+			if (b.loop && b.ensure > b.loop.ensure) || (!b.loop && b.parent && b.ensure > 0 && self.ntype == NODE_NEXT) {
+				vm.throw_reason = TR_THROW_EXCEPTION;
+				vm.throw_value = TrException_new(vm, vm.cSyntaxError, tr_sprintf(vm, "%s across an ensure clause isn't supported", keyword));
+				return TR_UNDEF;
+			}
+			switch {
+				// out of the while or back to its condition
+				case b.loop && self.ntype == NODE_BREAK:
+					if reg != b.loop.reg { b.code.Push(MachineOp{OpCode: TR_OP_MOVE, A: b.loop.reg, B: reg}); }
+					b.code.Push(MachineOp{OpCode: TR_OP_JMP});
+					b.loop.breaks.Push(b.code.Len() - 1);
+				case b.loop:
+					i := newExtendedOP(TR_OP_JMP, 0, 0);
+					i.SetxBx(b.loop.start - (b.code.Len() + 1));
+					b.code.Push(i);
+				// break leaves the method the block was passed to, next returns to its yield
+				case b.parent && self.ntype == NODE_BREAK:
+					b.code.Push(MachineOp{OpCode: TR_OP_THROW, A: TR_THROW_BREAK, B: reg});
+				case b.parent:
+					b.code.Push(MachineOp{OpCode: TR_OP_RETURN, A: reg});
+				default:
+					vm.throw_reason = TR_THROW_EXCEPTION;
+					vm.throw_value = TrException_new(vm, vm.cSyntaxError, tr_sprintf(vm, "Invalid %s", keyword));
+					return TR_UNDEF;
+			}
 
 		case NODE_YIELD: {
 			argc := 0;
@@ -457,8 +916,18 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 				// add parameters as locals in method context
 				blk.argc = self.args[1].kv.Len();
 				for parameter := range self.args[1].Iter() {
+					if parameter.args[1] == 3 {
+						vm.throw_reason = TR_THROW_EXCEPTION;
+						vm.throw_value = TrException_new(vm, vm.cSyntaxError, tr_sprintf(vm, "Destructuring parameters are only supported in blocks"));
+						return TR_UNDEF;
+					}
 					blk.push_local(parameter.args[0]);
-					if parameter.args[1] { blk.arg_splat = 1; }
+					if parameter.args[1] == 1 { blk.arg_splat = 1; }
+					// &block is not counted as an arg
+					if parameter.args[1] == 2 {
+						blk.arg_block = true;
+						blk.argc--;
+					}
 					// compile default expression and store location in defaults table for later jump when executing
 					if parameter.args[2] {
 						if blk_reg >= b.regc { b.regc = blk_reg + 1; }
@@ -510,7 +979,7 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 			if (self.ntype == NODE_CLASS) {
 				// superclass
 				if self.args[1] {
-					b.code.Push(newExtendedOP(TR_OP_GETCONST, reg, b.push_value(self.args[1])));
+					self.args[1].compile(vm, c, b, reg);
 				} else {
 					b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: reg});
 				}
@@ -521,15 +990,143 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 				b.code.Push(newExtendedOP(TR_OP_MODULE, blki, b.push_value(self.args[0])));
 			}
 
+		case NODE_BEGIN:
+			// begin
+			//   body            <- protected by the rescue handler
+			//   else body
+			//   jmp ensure
+			// rescue handler:   <- R[reg] = $!
+			//   rescue clauses, each one jumping to ensure when matched
+			//   throw R[reg]
+			// ensure:           <- everything above is protected by the ensure handler
+			//   ensure body
+			//   jmp end
+			// ensure handler:   <- R[reg], R[reg+1], R[reg+2] = thrown value, reason, stop
+			//   ensure body
+			//   rethrow R[reg]
+			// end:
+			ensure := self.args[2];
+			has_ensure := ensure && ensure.args[1];
+			if has_ensure { b.ensure++; }
+			jmps := Vector.New(0);
+			start := b.code.Len();
+			for node := range self.args[0].Iter() {
+				nlocal := b.locals.Len();
+				if reg >= b.regc { b.regc = reg + 1; }
+				node.compile(vm, c, b, reg);
+				reg += b.locals.Len() - nlocal;
+				if reg >= b.regc { b.regc = reg + 1; }
+			}
+			body_end := b.code.Len();
+			if ensure && ensure.args[0] {
+				for node := range ensure.args[0].Iter() {
+					nlocal := b.locals.Len();
+					if reg >= b.regc { b.regc = reg + 1; }
+					node.compile(vm, c, b, reg);
+					reg += b.locals.Len() - nlocal;
+					if reg >= b.regc { b.regc = reg + 1; }
+				}
+			}
+			b.code.Push(MachineOp{OpCode: TR_OP_JMP});
+			jmps.Push(b.code.Len() - 1);
+
+			if self.args[1] {
+				handler := b.code.Len();
+				exc_reg := reg;
+				for clause := range self.args[1].Iter() {
+					// classes to match, StandardError if none
+					nclasses := 0;
+					if clause.args[0] {
+						nclasses = clause.args[0].kv.Len();
+						index := 0;
+						for class := range clause.args[0].Iter() {
+							new_reg := exc_reg + index + 2;
+							if new_reg >= b.regc { b.regc = new_reg + 1; }
+							class.compile(vm, c, b, new_reg);
+							index++;
+						}
+					}
+					if exc_reg + 1 >= b.regc { b.regc = exc_reg + 2; }
+					b.code.Push(MachineOp{OpCode: TR_OP_RESCUE, A: exc_reg, B: nclasses});
+					b.code.Push(MachineOp{OpCode: TR_OP_JMPUNLESS, A: exc_reg + 1});
+					jmp := b.code.Len() - 1;
+					// rescue ... => name
+					if clause.args[1] {
+						nlocal := b.locals.Len();
+						newASTNode(vm, NODE_ASSIGN, clause.args[1], newASTNode(vm, NODE_GETGLOBAL, TrSymbol_new(vm, "$!"), 0, 0, clause.line), 0, clause.line).compile(vm, c, b, reg);
+						// the body goes after the local, not over it
+						reg += b.locals.Len() - nlocal;
+						if reg >= b.regc { b.regc = reg + 1; }
+					}
+					for node := range clause.args[2].Iter() {
+						nlocal := b.locals.Len();
+						if reg >= b.regc { b.regc = reg + 1; }
+						node.compile(vm, c, b, reg);
+						reg += b.locals.Len() - nlocal;
+						if reg >= b.regc { b.regc = reg + 1; }
+					}
+					b.code.Push(MachineOp{OpCode: TR_OP_JMP});
+					jmps.Push(b.code.Len() - 1);
+					b.code.At(jmp).Set_sBx(b.code.Len() - jmp - 1);
+				}
+				// no clause matched, keep propagating
+				b.code.Push(MachineOp{OpCode: TR_OP_THROW, A: TR_THROW_EXCEPTION, B: exc_reg});
+				b.handlers.Push(Handler{start: start, end: body_end, handler: handler, reg: exc_reg});
+			}
+
+			ensure_start := b.code.Len();
+			for jmp := range jmps.Iter() { b.code.At(jmp).Set_sBx(ensure_start - jmp - 1); }
+			if has_ensure {
+				b.ensure--;
+				// the ensure handler gets the thrown value, reason and stop even with an empty body
+				if reg + 3 > b.regc { b.regc = reg + 3; }
+				// normal path, keep the value of the begin block in reg
+				ensure_reg := reg + 1;
+				for node := range ensure.args[1].Iter() {
+					nlocal := b.locals.Len();
+					if ensure_reg >= b.regc { b.regc = ensure_reg + 1; }
+					node.compile(vm, c, b, ensure_reg);
+					ensure_reg += b.locals.Len() - nlocal;
+					if ensure_reg >= b.regc { b.regc = ensure_reg + 1; }
+				}
+				b.code.Push(MachineOp{OpCode: TR_OP_JMP});
+				jmp := b.code.Len() - 1;
+
+				// throw path, run the ensure body and throw again
+				handler := b.code.Len();
+				ensure_reg = reg + 3;
+				for node := range ensure.args[1].Iter() {
+					nlocal := b.locals.Len();
+					if ensure_reg >= b.regc { b.regc = ensure_reg + 1; }
+					node.compile(vm, c, b, ensure_reg);
+					ensure_reg += b.locals.Len() - nlocal;
+					if ensure_reg >= b.regc { b.regc = ensure_reg + 1; }
+				}
+				b.code.Push(MachineOp{OpCode: TR_OP_RETHROW, A: reg});
+				b.handlers.Push(Handler{start: start, end: ensure_start, handler: handler, reg: reg, ensure: true});
+				b.code.At(jmp).Set_sBx(b.code.Len() - jmp - 1);
+			}
+
 		case NODE_CONST:
-			b.code.Push(newExtendedOP(TR_OP_GETCONST, reg, b.push_value(self.args[0])));
+			switch {
+				case self.args[1]:
+					// Scope::Name
+					self.args[1].compile(vm, c, b, reg);
+					b.code.Push(newExtendedOP(TR_OP_GETSCOPE, reg, b.push_value(self.args[0])));
+				case self.args[2]:
+					// ::Name
+					b.code.Push(MachineOp{OpCode: TR_OP_NIL, A: reg});
+					b.code.Push(newExtendedOP(TR_OP_GETSCOPE, reg, b.push_value(self.args[0])));
+				default:
+					b.code.Push(newExtendedOP(TR_OP_GETCONST, reg, b.push_value(self.args[0])));
+			}
 
 		case NODE_SETCONST:
 			if reg >= b.regc { b.regc = reg + 1; }
 			self.args[1].compile(vm, c, b, reg);
 			b.code.Push(newExtendedOP(TR_OP_SETCONST, reg, b.push_value(self.args[0])));
 
-		case NODE_ADD, NODE_SUB, NODE_LT:
+		case NODE_ADD, NODE_SUB, NODE_LT, NODE_MUL, NODE_DIV, NODE_MOD, NODE_EQ, NODE_LE, NODE_GT, NODE_GE:
 			rcv := self.args[0].compile_to_RK(vm, c, b, reg);
 			arg := self.args[1].compile_to_RK(vm, c, b, reg + 1);
 			if (reg + 1) >= b.regc { b.regc = reg + 2; }
@@ -537,6 +1134,13 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 				case NODE_ADD:	b.code.Push(MachineOp{OpCode: TR_OP_ADD, A: reg, B: rcv, C: arg});
 				case NODE_SUB:	b.code.Push(MachineOp{OpCode: TR_OP_SUB, A: reg, B: rcv, C: arg});
 				case NODE_LT:	b.code.Push(MachineOp{OpCode: TR_OP_LT, A: reg, B: rcv, C: arg});
+				case NODE_MUL:	b.code.Push(MachineOp{OpCode: TR_OP_MUL, A: reg, B: rcv, C: arg});
+				case NODE_DIV:	b.code.Push(MachineOp{OpCode: TR_OP_DIV, A: reg, B: rcv, C: arg});
+				case NODE_MOD:	b.code.Push(MachineOp{OpCode: TR_OP_MOD, A: reg, B: rcv, C: arg});
+				case NODE_EQ:	b.code.Push(MachineOp{OpCode: TR_OP_EQ, A: reg, B: rcv, C: arg});
+				case NODE_LE:	b.code.Push(MachineOp{OpCode: TR_OP_LE, A: reg, B: rcv, C: arg});
+				case NODE_GT:	b.code.Push(MachineOp{OpCode: TR_OP_GT, A: reg, B: rcv, C: arg});
+				case NODE_GE:	b.code.Push(MachineOp{OpCode: TR_OP_GE, A: reg, B: rcv, C: arg});
 				default:		assert(0);
 			}
 
@@ -557,6 +1161,11 @@ func (self *ASTNode) compile(vm *RubyVM, c *Compiler, b *Block, reg int) RubyObj
 			printf("Compiler: unknown node type: %d in %s:%lu\n", self.ntype, b.filename.ptr, b.line);
 			if vm.debug { assert(0); }
 	}
+	// instructions emitted for this node and not claimed by a child node are at its position,
+	// the one of the message for a call, where errors of the lookup and arguments are
+	line, column := self.line, self.column;
+	if self.ntype == NODE_SEND && self.args[1] && self.args[1].column > 0 { line, column = self.args[1].line, self.args[1].column; }
+	b.mark_lines(line, column);
 	return TR_NIL;
 }
 
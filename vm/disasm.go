@@ -0,0 +1,295 @@
+import (
+	"bytes";
+	"encoding/json";
+	"fmt";
+	"tr";
+	"opcode";
+)
+
+// How the operands of an instruction are read.
+const (
+	TR_FORMAT_A = iota;			// A
+	TR_FORMAT_AB;				// A B
+	TR_FORMAT_ABC;				// A B C
+	TR_FORMAT_ABx;				// A Bx
+	TR_FORMAT_AsBx;				// A sBx
+	)
+
+const OPCODE_FORMATS = []int {
+	TR_FORMAT_A,	TR_FORMAT_AB,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_AB,	TR_FORMAT_A,	TR_FORMAT_A,	TR_FORMAT_ABx,		// boing .. lookup
+	TR_FORMAT_ABx,	TR_FORMAT_ABC,	TR_FORMAT_AsBx,	TR_FORMAT_AsBx,	TR_FORMAT_AsBx,	TR_FORMAT_A,	TR_FORMAT_AB,	TR_FORMAT_AB,		// cache .. setupval
+	TR_FORMAT_AB,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_AB,		// getupval .. newarray
+	TR_FORMAT_AB,	TR_FORMAT_AB,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,	TR_FORMAT_ABx,		// newhash .. setglobal
+	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_AB,	TR_FORMAT_AB,	TR_FORMAT_AB,	TR_FORMAT_A,		// newrange .. rethrow
+	TR_FORMAT_A,	TR_FORMAT_ABx,	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_ABC,		// super .. gt
+	TR_FORMAT_ABC,	TR_FORMAT_ABC,	TR_FORMAT_ABC																	// ge .. unpack
+}
+
+// One disassembled instruction. Const is the value of k or strings it refers to, Upval the name
+// of the upvalue, Target the index of the instruction it jumps to, Block the nested block it uses.
+type Instruction struct {
+	Index		int			`json:"index"`;
+	Opcode		string		`json:"opcode"`;
+	Operands	[]int		`json:"operands"`;
+	Const		string		`json:"const,omitempty"`;
+	Upval		string		`json:"upval,omitempty"`;
+	Target		*int		`json:"target,omitempty"`;
+	Block		*int		`json:"block,omitempty"`;
+	Line		int			`json:"line"`;
+	Column		int			`json:"column,omitempty"`;
+	Comment		string		`json:"comment,omitempty"`;		// what the instruction does, in terms of registers
+}
+
+type LineListing struct {
+	Start		int			`json:"start"`;			// first instruction at this position
+	Line		int			`json:"line"`;
+	Column		int			`json:"column"`;
+}
+
+type HandlerListing struct {
+	Type		string		`json:"type"`;			// rescue or ensure
+	Start		int			`json:"start"`;
+	End			int			`json:"end"`;
+	Target		int			`json:"target"`;
+	Reg			int			`json:"reg"`;
+}
+
+// The disassembly of a Block and of the blocks nested in it.
+type Listing struct {
+	Filename	string				`json:"filename"`;
+	Line		int					`json:"line"`;
+	Registers	int					`json:"registers"`;
+	Args		int					`json:"args"`;
+	Splat		bool				`json:"splat"`;
+	BlockArg	bool				`json:"block_arg"`;
+	Defaults	[]int				`json:"defaults"`;
+	Locals		[]string			`json:"locals"`;
+	Upvals		[]string			`json:"upvals"`;
+	Consts		[]string			`json:"consts"`;
+	Strings		[]string			`json:"strings"`;
+	Handlers	[]HandlerListing	`json:"handlers"`;
+	Lines		[]LineListing		`json:"lines"`;
+	Code		[]Instruction		`json:"code"`;
+	Blocks		[]*Listing			`json:"blocks"`;
+}
+
+// Renders a value of k, locals or upvals the way it's written in Ruby, without calling any Ruby code.
+func disasm_value(vm *RubyVM, v *RubyObject) string {
+	switch {
+		case v == TR_NIL: return "nil";
+		case v == TR_TRUE: return "true";
+		case v == TR_FALSE: return "false";
+		case TR_IS_FIX(v): return fmt.Sprintf("%d", TR_FIX2INT(v));
+		case v.(Symbol): return v.ptr;
+		case v.(String): return fmt.Sprintf("%q", v.ptr);
+		case v.(Float): return fmt.Sprintf("%g", Float *(v).value);
+		case v.(Bignum): return Bignum *(v).value.String();
+		case v.(Regexp): return "/" + TrRegexp *(v).source + "/";
+	}
+	return fmt.Sprintf("#<%s>", Class *(Object_class(vm, v)).name.ptr);
+}
+
+func disasm_values(vm *RubyVM, values Vector) []string {
+	names := make([]string, 0, values.Len());
+	for _, v := range values.Iter() { names = append(names, disasm_value(vm, v)); }
+	return names;
+}
+
+// An RK operand, a register or a constant when flagged with 0x100.
+func disasm_rk(vm *RubyVM, b *Block, x int) string {
+	if x & 0x100 != 0 { return disasm_value(vm, b.k.At(x & 0xff)); }
+	return fmt.Sprintf("R[%d]", x);
+}
+
+func disasm_instruction(vm *RubyVM, b *Block, index int, op MachineOp) Instruction {
+	i := Instruction{Index: index, Opcode: OPCODE_NAMES[op.OpCode]};
+	i.Line, i.Column = b.position_at(index);
+	A, B, C := int(op.A), int(op.B), int(op.C);
+	switch OPCODE_FORMATS[op.OpCode] {
+		case TR_FORMAT_A: i.Operands = []int{ A };
+		case TR_FORMAT_AB: i.Operands = []int{ A, B };
+		case TR_FORMAT_ABC: i.Operands = []int{ A, B, C };
+		case TR_FORMAT_ABx: i.Operands = []int{ A, int(op.Get_Bx()) };
+		case TR_FORMAT_AsBx:
+			i.Operands = []int{ A, int(op.Get_sBx()) };
+			target := index + 1 + int(op.Get_sBx());
+			i.Target = &target;
+	}
+	k := func() string { return disasm_value(vm, b.k.At(op.Get_Bx())); };
+	switch op.OpCode {
+		case TR_OP_MOVE:
+			i.Comment = fmt.Sprintf("R[%d] = R[%d]", A, B);
+		case TR_OP_LOADK:
+			i.Const = k();
+			i.Comment = fmt.Sprintf("R[%d] = %s", A, i.Const);
+		case TR_OP_STRING:
+			i.Const = fmt.Sprintf("%q", b.strings.At(op.Get_Bx()));
+			i.Comment = fmt.Sprintf("R[%d] = %s", A, i.Const);
+		case TR_OP_BOOL:
+			i.Comment = fmt.Sprintf("R[%d] = %s", A, disasm_value(vm, RubyObject(op.B)));
+		case TR_OP_NIL:
+			i.Comment = fmt.Sprintf("R[%d] = nil", A);
+		case TR_OP_SELF:
+			i.Comment = fmt.Sprintf("R[%d] = self", A);
+		case TR_OP_LOOKUP:
+			i.Const = k();
+			i.Comment = fmt.Sprintf("R[%d] = R[%d].method(:%s)", A + 1, A, i.Const);
+		case TR_OP_CACHE:
+			i.Comment = fmt.Sprintf("sites[%d], skips the lookup when it holds the class of R[%d]", op.Get_Bx(), A);
+		case TR_OP_CALL:
+			i.Comment = fmt.Sprintf("R[%d] = R[%d].R[%d](%d args from R[%d]", A, A, A + 1, B >> 1, A + 2);
+			if B & 1 != 0 { i.Comment += ", last one splat"; }
+			switch {
+				case C == TR_CALL_BLOCK_PASS:
+					i.Comment += fmt.Sprintf(", &R[%d]", A + 2 + B >> 1);
+				case C > 0:
+					blk := C - 1;
+					i.Block = &blk;
+					i.Comment += fmt.Sprintf(", blocks[%d]", blk);
+			}
+			i.Comment += ")";
+		case TR_OP_JMP:
+			i.Comment = fmt.Sprintf("goto %03d", *i.Target);
+		case TR_OP_JMPIF:
+			i.Comment = fmt.Sprintf("goto %03d if R[%d]", *i.Target, A);
+		case TR_OP_JMPUNLESS:
+			i.Comment = fmt.Sprintf("goto %03d unless R[%d]", *i.Target, A);
+		case TR_OP_RETURN:
+			i.Comment = fmt.Sprintf("return R[%d]", A);
+		case TR_OP_THROW:
+			reasons := []string{ "exception", "return", "break" };
+			i.Comment = fmt.Sprintf("throw %s R[%d]", reasons[A], B);
+		case TR_OP_SETUPVAL:
+			i.Upval = disasm_value(vm, b.upvals.At(B));
+			i.Comment = fmt.Sprintf("%s = R[%d]", i.Upval, A);
+		case TR_OP_GETUPVAL:
+			i.Upval = disasm_value(vm, b.upvals.At(B));
+			i.Comment = fmt.Sprintf("R[%d] = %s", A, i.Upval);
+		case TR_OP_DEF:
+			i.Const = k();
+			i.Block = &A;
+			i.Comment = fmt.Sprintf("def %s, blocks[%d]", i.Const, A);
+		case TR_OP_METADEF:
+			i.Const = k();
+			i.Block = &A;
+			i.Comment = fmt.Sprintf("def R[nA].%s, blocks[%d]", i.Const, A);
+		case TR_OP_GETCONST:
+			i.Const = k();
+			i.Comment = fmt.Sprintf("R[%d] = %s", A, i.Const);
+		case TR_OP_SETCONST:
+			i.Const = k();
+			i.Comment = fmt.Sprintf("%s = R[%d]", i.Const, A);
+		case TR_OP_CLASS:
+			i.Const = k();
+			i.Block = &A;
+			i.Comment = fmt.Sprintf("class %s < R[nA], blocks[%d]", i.Const, A);
+		case TR_OP_MODULE:
+			i.Const = k();
+			i.Block = &A;
+			i.Comment = fmt.Sprintf("module %s, blocks[%d]", i.Const, A);
+		case TR_OP_NEWARRAY:
+			i.Comment = fmt.Sprintf("R[%d] = [%d values from R[%d]]", A, B, A + 1);
+		case TR_OP_NEWHASH:
+			i.Comment = fmt.Sprintf("R[%d] = {%d pairs from R[%d]}", A, B, A + 1);
+		case TR_OP_YIELD:
+			i.Comment = fmt.Sprintf("R[%d] = yield(%d args from R[%d])", A, B, A + 1);
+		case TR_OP_GETIVAR, TR_OP_GETCVAR, TR_OP_GETGLOBAL:
+			i.Const = k();
+			i.Comment = fmt.Sprintf("R[%d] = %s", A, i.Const);
+		case TR_OP_SETIVAR, TR_OP_SETCVAR, TR_OP_SETGLOBAL:
+			i.Const = k();
+			i.Comment = fmt.Sprintf("%s = R[%d]", i.Const, A);
+		case TR_OP_NEWRANGE:
+			if C != 0 {
+				i.Comment = fmt.Sprintf("R[%d] = R[%d]...R[%d]", A, A, B);
+			} else {
+				i.Comment = fmt.Sprintf("R[%d] = R[%d]..R[%d]", A, A, B);
+			}
+		case TR_OP_ADD, TR_OP_SUB, TR_OP_MUL, TR_OP_DIV, TR_OP_MOD, TR_OP_LT, TR_OP_LE, TR_OP_GT, TR_OP_GE, TR_OP_EQ:
+			operators := map[int]string{ TR_OP_ADD: "+", TR_OP_SUB: "-", TR_OP_MUL: "*", TR_OP_DIV: "/", TR_OP_MOD: "%",
+										 TR_OP_LT: "<", TR_OP_LE: "<=", TR_OP_GT: ">", TR_OP_GE: ">=", TR_OP_EQ: "==" };
+			i.Comment = fmt.Sprintf("R[%d] = %s %s %s", A, disasm_rk(vm, b, B), operators[op.OpCode], disasm_rk(vm, b, C));
+		case TR_OP_NEG:
+			i.Comment = fmt.Sprintf("R[%d] = -%s", A, disasm_rk(vm, b, B));
+		case TR_OP_NOT:
+			i.Comment = fmt.Sprintf("R[%d] = !%s", A, disasm_rk(vm, b, B));
+		case TR_OP_RESCUE:
+			i.Comment = fmt.Sprintf("R[%d] = R[%d] is one of the %d classes from R[%d]", A + 1, A, B, A + 2);
+		case TR_OP_RETHROW:
+			i.Comment = fmt.Sprintf("throw R[%d] again", A);
+		case TR_OP_SUPER:
+			i.Comment = fmt.Sprintf("R[%d] = overridden method, cached in sites[%d]", A + 1, op.Get_Bx());
+		case TR_OP_GETSCOPE:
+			i.Const = k();
+			i.Comment = fmt.Sprintf("R[%d] = R[%d]::%s", A, A, i.Const);
+		case TR_OP_DSTR:
+			i.Comment = fmt.Sprintf("R[%d] = \"#{R[%d]}..#{R[%d]}\"", A, A, A + B - 1);
+			if C != 0 { i.Comment += " as a Regexp"; }
+		case TR_OP_UNPACK:
+			i.Comment = fmt.Sprintf("R[%d]..R[%d] = *R[%d]", A + 1, A + B, A);
+			if C > 0 { i.Comment += fmt.Sprintf(", rest in R[%d]", A + C); }
+	}
+	return i;
+}
+
+// Returns the structured listing of b and its nested blocks.
+func Block_disassemble(vm *RubyVM, b *Block) *Listing {
+	l := &Listing{	Filename: b.filename.ptr, Line: b.line, Registers: b.regc, Args: b.argc,
+					Splat: b.arg_splat != 0, BlockArg: b.arg_block,
+					Locals: disasm_values(vm, b.locals), Upvals: disasm_values(vm, b.upvals),
+					Consts: disasm_values(vm, b.k) };
+	for _, d := range b.defaults.Iter() { l.Defaults = append(l.Defaults, d); }
+	for _, s := range b.strings.Iter() { l.Strings = append(l.Strings, s); }
+	for _, h := range b.handlers.Iter() {
+		kind := "rescue";
+		if h.ensure { kind = "ensure"; }
+		l.Handlers = append(l.Handlers, HandlerListing{Type: kind, Start: h.start, End: h.end, Target: h.handler, Reg: h.reg});
+	}
+	for _, entry := range b.line_table.Iter() { l.Lines = append(l.Lines, LineListing{Start: entry.pc, Line: entry.line, Column: entry.column}); }
+	for index, op := range b.code.Iter() { l.Code = append(l.Code, disasm_instruction(vm, b, index, op)); }
+	for _, blk := range b.blocks.Iter() { l.Blocks = append(l.Blocks, Block_disassemble(vm, blk)); }
+	return l;
+}
+
+func (l *Listing) JSON() string {
+	data, _ := json.MarshalIndent(l, "", "  ");
+	return string(data);
+}
+
+// Returns the listing as assembly like text, instructions jumped to are prefixed with a >.
+func (l *Listing) Text() string {
+	buf := new(bytes.Buffer);
+	l.write_text(buf, "0");
+	return buf.String();
+}
+
+func (l *Listing) write_text(buf *bytes.Buffer, path string) {
+	fmt.Fprintf(buf, "; block %s of %s:%d\n", path, l.Filename, l.Line);
+	fmt.Fprintf(buf, "; %d registers ; %d args", l.Registers, l.Args);
+	if l.Splat { fmt.Fprintf(buf, ", splat"); }
+	if l.BlockArg { fmt.Fprintf(buf, ", &block"); }
+	fmt.Fprintf(buf, " ; %d nested blocks\n", len(l.Blocks));
+	if len(l.Defaults) > 0 { fmt.Fprintf(buf, "; defaults table: %v\n", l.Defaults); }
+	for n, name := range l.Locals { fmt.Fprintf(buf, ".local  %-8s ; %d\n", name, n); }
+	for n, name := range l.Upvals { fmt.Fprintf(buf, ".upval  %-8s ; %d\n", name, n); }
+	for n, value := range l.Consts { fmt.Fprintf(buf, ".value  %-8s ; %d\n", value, n); }
+	for n, s := range l.Strings { fmt.Fprintf(buf, ".string %-8q ; %d\n", s, n); }
+	targets := make(map[int] bool);
+	for _, h := range l.Handlers {
+		fmt.Fprintf(buf, ".%-6s [%03d-%03d) => %03d ; R[%d]\n", h.Type, h.Start, h.End, h.Target, h.Reg);
+		targets[h.Target] = true;
+	}
+	for _, entry := range l.Lines { fmt.Fprintf(buf, ".line   [%03d] %d:%d\n", entry.Start, entry.Line, entry.Column); }
+	for _, i := range l.Code {
+		if i.Target != nil { targets[*i.Target] = true; }
+	}
+	for _, i := range l.Code {
+		mark := " ";
+		if targets[i.Index] { mark = ">"; }
+		operands := "";
+		for _, x := range i.Operands { operands += fmt.Sprintf(" %4d", x); }
+		fmt.Fprintf(buf, "%s[%03d] %-10s%-15s ; %-10s %s\n", mark, i.Index, i.Opcode, operands, fmt.Sprintf("line %d:%d", i.Line, i.Column), i.Comment);
+	}
+	fmt.Fprintf(buf, "; block %s end\n\n", path);
+	for n, blk := range l.Blocks { blk.write_text(buf, fmt.Sprintf("%s.%d", path, n)); }
+}
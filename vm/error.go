@@ -1,4 +1,7 @@
-import "tr"
+import (
+	"fmt";
+	"tr";
+)
 
 /* Exception
  NoMemoryError
@@ -32,43 +35,48 @@ import "tr"
 func TrException_new(vm *RubyVM, class, message *RubyObject) RubyObject {
 	e := Object_alloc(vm, class);
 	e.ivars[TrSymbol_new(vm, "@message"] = message;
-	e.ivars[TrSymbol_new(vm, "@backtrace"] = TR_NIL;
+	// raise replaces it with the backtrace where the exception is raised
+	e.ivars[TrSymbol_new(vm, "@backtrace"] = vm.backtrace();
+	e.ivars[TrSymbol_new(vm, "@location"] = vm.location();
 	return e;
 }
 
-func TrException_cexception(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) {
+func TrException_cexception(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	if !self.(Class) && !self.(Module) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
 		return TR_UNDEF;
 	}
-	if argc == 0 { return TrException_new(vm, self, self.name); }
-	return TrException_new(vm, self, argv[0]);
+	if len(args) == 0 { return TrException_new(vm, self, self.name); }
+	return TrException_new(vm, self, args[0]);
 }
 
-func TrException_iexception(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) RubyObject {
-	if (argc == 0) return self;
+func TrException_iexception(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if (len(args) == 0) return self;
 	if TR_IMMEDIATE(self) {
 		class := vm.classes[Object_type(vm, self)];
 	} else {
 		class := Object *(self).class;
 	}
-	return TrException_new(vm, class, argv[0]);
+	return TrException_new(vm, class, args[0]);
 }
 
-func TrException_message(vm *RubyVM, self *RubyObject) RubyObject {
+func TrException_message(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	return self.ivars[TrSymbol_new(vm, "@message")] || TR_NIL;
 }
 
-func TrException_backtrace(vm *RubyVM, self *RubyObject) RubyObject {
+func TrException_backtrace(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	return self.ivars[TrSymbol_new(vm, "@backtrace")] || TR_NIL;
 }
 
-func TrException_set_backtrace(vm *RubyVM, self, backtrace *RubyObject) RubyObject {
+func TrException_set_backtrace(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	backtrace := args[0];
 	self.ivars[TrSymbol_new(vm, "@backtrace")] = backtrace;
+	return backtrace;
 }
 
-func TrException_default_handler(vm *RubyVM, exception *RubyObject) RubyObject {
+// Prints exception and its backtrace.
+func TrException_report(vm *RubyVM, exception *RubyObject) RubyObject {
 	if TR_IMMEDIATE(exception) {
 		exception_class := vm.classes[Object_type(vm, exception)];
 	} else {
@@ -92,7 +100,10 @@ func TrException_default_handler(vm *RubyVM, exception *RubyObject) RubyObject {
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + msg));
 		return TR_UNDEF;
 	}
-	printf("%s: %s\n", exception_class.name.ptr, msg.ptr);
+	fmt.Fprintf(vm.out, "%s: %s\n", exception_class.name.ptr, msg.ptr);
+	// the line isn't enough to tell which of the names on it is unknown
+	location := exception.ivars[TrSymbol_new(vm, "@location")] || TR_NIL;
+	if location != TR_NIL && Object_kind_of(vm, exception, vm.cNameError) == TR_TRUE { fmt.Fprintf(vm.out, "\tat %s\n", location.ptr); }
 	if backtrace {
 		for item := range backtrace.Iter() {
 			if !item.(String) && !item.(Symbol) {
@@ -100,22 +111,30 @@ func TrException_default_handler(vm *RubyVM, exception *RubyObject) RubyObject {
 				vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + item));
 				return TR_UNDEF;
 			}
-			println(item.ptr);
+			fmt.Fprintf(vm.out, "\tfrom %s\n", item.ptr);
 		}
 	}
+	return TR_NIL;
+}
+
+// Reports an exception nothing rescued and exits.
+func TrException_default_handler(vm *RubyVM, exception *RubyObject) RubyObject {
+	TrException_report(vm, exception);
 	vm.destroy();
 	exit(1);
 }
 
 func TrError_init(vm *RubyVM) {
 	c := vm.cException = Object_const_set(vm, vm.self, TrSymbol_new(vm, "Exception"), newClass(vm, TrSymbol_new(vm, "Exception"), 0));
-	Object_add_singleton_method(vm, c, TrSymbol_new(vm, "exception"), newMethod(vm, (TrFunc *)TrException_cexception, TR_NIL, -1));
-	c.add_method(vm, TrSymbol_new(vm, "exception"), newMethod(vm, (TrFunc *)TrException_iexception, TR_NIL, -1));
-	c.add_method(vm, TrSymbol_new(vm, "backtrace"), newMethod(vm, (TrFunc *)TrException_backtrace, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "message"), newMethod(vm, (TrFunc *)TrException_message, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, (TrFunc *)TrException_message, TR_NIL, 0));
+	Object_add_singleton_method(vm, c, TrSymbol_new(vm, "exception"), newMethod(vm, TrException_cexception, TR_NIL, -1));
+	c.add_method(vm, TrSymbol_new(vm, "exception"), newMethod(vm, TrException_iexception, TR_NIL, -1));
+	c.add_method(vm, TrSymbol_new(vm, "backtrace"), newMethod(vm, TrException_backtrace, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "set_backtrace"), newMethod(vm, TrException_set_backtrace, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "message"), newMethod(vm, TrException_message, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrException_message, TR_NIL, 0));
 
 	vm.cScriptError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "ScriptError"), newClass(vm, TrSymbol_new(vm, "ScriptError"), vm.cException));
+	vm.cLoadError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "LoadError"), newClass(vm, TrSymbol_new(vm, "LoadError"), vm.cScriptError));
 	vm.cSyntaxError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "SyntaxError"), newClass(vm, TrSymbol_new(vm, "SyntaxError"), vm.cScriptError));
 	vm.cStandardError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "StandardError"), newClass(vm, TrSymbol_new(vm, "StandardError"), vm.cException));
 	vm.cArgumentError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "ArgumentError"), newClass(vm, TrSymbol_new(vm, "ArgumentError"), vm.cStandardError));
@@ -128,4 +147,7 @@ func TrError_init(vm *RubyVM) {
 	vm.cSystemStackError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "SystemStackError"), newClass(vm, TrSymbol_new(vm, "SystemStackError"), vm.cStandardError));
 	vm.cNameError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "NameError"), newClass(vm, TrSymbol_new(vm, "NameError"), vm.cStandardError));
 	vm.cNoMethodError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "NoMethodError"), newClass(vm, TrSymbol_new(vm, "NoMethodError"), vm.cNameError));
+	vm.cZeroDivisionError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "ZeroDivisionError"), newClass(vm, TrSymbol_new(vm, "ZeroDivisionError"), vm.cStandardError));
+	vm.cRangeError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "RangeError"), newClass(vm, TrSymbol_new(vm, "RangeError"), vm.cStandardError));
+	vm.cFloatDomainError = Object_const_set(vm, vm.self, TrSymbol_new(vm, "FloatDomainError"), newClass(vm, TrSymbol_new(vm, "FloatDomainError"), vm.cRangeError));
 }
\ No newline at end of file
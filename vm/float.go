@@ -0,0 +1,226 @@
+import (
+	"tr";
+	"math";
+	"math/big";
+	"strconv";
+	"strings";
+)
+
+type Float struct {
+	type			TR_T;
+	class			*RubyObject;
+	ivars			map[string] RubyObject;
+	value			float64;
+}
+
+func TrFloat_new(vm *RubyVM, value float64) RubyObject {
+	return Float{type: TR_T_Float, class: vm.classes[TR_T_Float], ivars: make(map[string] RubyObject), value: value};
+}
+
+// Returns the value of a Fixnum, Bignum or Float as a float64, ok is false for any other object.
+func TrNumeric_to_float(obj *RubyObject) (value float64, ok bool) {
+	if TR_IS_FIX(obj) { return float64(TR_FIX2INT(obj)), true; }
+	if TR_IMMEDIATE(obj) { return 0, false; }
+	if obj.(Float) { return Float *(obj).value, true; }
+	if obj.(Bignum) {
+		value, _ = new(big.Float).SetInt(Bignum *(obj).value).Float64();
+		return value, true;
+	}
+	return 0, false;
+}
+
+// Does self op other through other.coerce(self), which returns a pair of numbers knowing how to do it.
+// Used when the receiver of an arithmetic operation doesn't know the class of other.
+func TrNumeric_coerce(vm *RubyVM, self, other, op *RubyObject) RubyObject {
+	if Object_method(vm, other, vm.sCOERCE) == TR_NIL {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		if op == vm.sLT || op == vm.sLE || op == vm.sGT || op == vm.sGE {
+			vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "comparison of %s with %s failed", Class *(Object_class(vm, self)).name.ptr, Class *(Object_class(vm, other)).name.ptr));
+		} else {
+			vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "%s can't be coerced into %s", Class *(Object_class(vm, other)).name.ptr, Class *(Object_class(vm, self)).name.ptr));
+		}
+		return TR_UNDEF;
+	}
+	pair := Object_send(vm, other, 2, { vm.sCOERCE, self });
+	if pair == TR_UNDEF { return TR_UNDEF; }
+	if TR_IMMEDIATE(pair) || !pair.(Array) || Array *(pair).values.Len() != 2 {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "coerce must return [x, y]"));
+		return TR_UNDEF;
+	}
+	return Object_send(vm, Array *(pair).values.At(0), 2, { op, Array *(pair).values.At(1) });
+}
+
+func TrFloat_add(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TrFloat_new(vm, Float *(self).value + y); }
+	return TrNumeric_coerce(vm, self, other, vm.sADD);
+}
+
+func TrFloat_sub(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TrFloat_new(vm, Float *(self).value - y); }
+	return TrNumeric_coerce(vm, self, other, vm.sSUB);
+}
+
+func TrFloat_mul(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TrFloat_new(vm, Float *(self).value * y); }
+	return TrNumeric_coerce(vm, self, other, vm.sMUL);
+}
+
+// Dividing by 0 gives Infinity or NaN, not ZeroDivisionError.
+func TrFloat_div(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TrFloat_new(vm, Float *(self).value / y); }
+	return TrNumeric_coerce(vm, self, other, vm.sDIV);
+}
+
+// The modulo has the sign of other, like Fixnum's.
+func TrFloat_mod(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok {
+		m := math.Mod(Float *(self).value, y);
+		if m != 0 && (m < 0) != (y < 0) { m += y; }
+		return TrFloat_new(vm, m);
+	}
+	return TrNumeric_coerce(vm, self, other, vm.sMOD);
+}
+
+func TrFloat_neg(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TrFloat_new(vm, -Float *(self).value);
+}
+
+func TrFloat_eq(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TR_BOOL(Float *(self).value == y); }
+	return TR_FALSE;
+}
+
+func TrFloat_lt(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TR_BOOL(Float *(self).value < y); }
+	return TrNumeric_coerce(vm, self, other, vm.sLT);
+}
+
+func TrFloat_le(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TR_BOOL(Float *(self).value <= y); }
+	return TrNumeric_coerce(vm, self, other, vm.sLE);
+}
+
+func TrFloat_gt(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TR_BOOL(Float *(self).value > y); }
+	return TrNumeric_coerce(vm, self, other, vm.sGT);
+}
+
+func TrFloat_ge(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return TR_BOOL(Float *(self).value >= y); }
+	return TrNumeric_coerce(vm, self, other, vm.sGE);
+}
+
+// Formats like Ruby does: always with a decimal point, in scientific notation for very large
+// or very small numbers.
+func TrFloat_to_s(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	value := Float *(self).value;
+	switch {
+		case math.IsNaN(value):		return TrString_new2(vm, "NaN");
+		case math.IsInf(value, 1):	return TrString_new2(vm, "Infinity");
+		case math.IsInf(value, -1):	return TrString_new2(vm, "-Infinity");
+	}
+	exp := 0;
+	if value != 0 { exp = int(math.Floor(math.Log10(math.Abs(value)))); }
+	if exp < -4 || exp >= 16 {
+		s := strconv.FormatFloat(value, 'e', -1, 64);
+		if !strings.Contains(s[0:strings.Index(s, "e")], ".") { s = strings.Replace(s, "e", ".0e", 1); }
+		return TrString_new2(vm, s);
+	}
+	s := strconv.FormatFloat(value, 'f', -1, 64);
+	if !strings.Contains(s, ".") { s += ".0"; }
+	return TrString_new2(vm, s);
+}
+
+func TrFloat_to_f(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return self;
+}
+
+// Returns the integral float value as a Fixnum or Bignum.
+func TrFloat_integer(vm *RubyVM, value float64) RubyObject {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cFloatDomainError, TrFloat_to_s(vm, TrFloat_new(vm, value), nil, nil));
+		return TR_UNDEF;
+	}
+	// float64(TR_FIX_MAX) rounds up to 2**62, which doesn't fit a Fixnum, normalize checks the bounds exactly
+	if value > TR_FIX_MIN && value < TR_FIX_MAX { return TR_INT2FIX(int(value)); }
+	n, _ := new(big.Float).SetFloat64(value).Int(nil);
+	return TrBignum_normalize(vm, n);
+}
+
+func TrFloat_to_i(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TrFloat_integer(vm, math.Trunc(Float *(self).value));
+}
+
+func TrFloat_floor(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TrFloat_integer(vm, math.Floor(Float *(self).value));
+}
+
+func TrFloat_ceil(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TrFloat_integer(vm, math.Ceil(Float *(self).value));
+}
+
+// Halves are rounded away from zero.
+func TrFloat_round(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	value := Float *(self).value;
+	if value < 0 { return TrFloat_integer(vm, -math.Floor(-value + 0.5)); }
+	return TrFloat_integer(vm, math.Floor(value + 0.5));
+}
+
+func TrFloat_is_nan(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TR_BOOL(math.IsNaN(Float *(self).value));
+}
+
+func TrFloat_is_infinite(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	value := Float *(self).value;
+	if math.IsInf(value, 1) { return TR_INT2FIX(1); }
+	if math.IsInf(value, -1) { return TR_INT2FIX(-1); }
+	return TR_NIL;
+}
+
+// Returns [other, self] both as Floats.
+func TrFloat_coerce(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if y, ok := TrNumeric_to_float(other); ok { return vm.newArray2(2, TrFloat_new(vm, y), self); }
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "%s can't be coerced into Float", Class *(Object_class(vm, other)).name.ptr));
+	return TR_UNDEF;
+}
+
+func TrFloat_init(vm *RubyVM) {
+	c := vm.classes[TR_T_Float] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Float), newClass(vm, TrSymbol_new(vm, Float), vm.classes[TR_T_Object]));
+	Object_const_set(vm, c, TrSymbol_new(vm, "INFINITY"), TrFloat_new(vm, math.Inf(1)));
+	Object_const_set(vm, c, TrSymbol_new(vm, "NAN"), TrFloat_new(vm, math.NaN()));
+	c.add_method(vm, TrSymbol_new(vm, "+"), newMethod(vm, TrFloat_add, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "-"), newMethod(vm, TrFloat_sub, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "*"), newMethod(vm, TrFloat_mul, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "/"), newMethod(vm, TrFloat_div, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "%"), newMethod(vm, TrFloat_mod, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "@-"), newMethod(vm, TrFloat_neg, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "=="), newMethod(vm, TrFloat_eq, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "<"), newMethod(vm, TrFloat_lt, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "<="), newMethod(vm, TrFloat_le, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, ">"), newMethod(vm, TrFloat_gt, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, ">="), newMethod(vm, TrFloat_ge, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrFloat_to_s, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "inspect"), newMethod(vm, TrFloat_to_s, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_f"), newMethod(vm, TrFloat_to_f, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_i"), newMethod(vm, TrFloat_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "floor"), newMethod(vm, TrFloat_floor, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "ceil"), newMethod(vm, TrFloat_ceil, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "round"), newMethod(vm, TrFloat_round, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "nan?"), newMethod(vm, TrFloat_is_nan, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "infinite?"), newMethod(vm, TrFloat_is_infinite, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "coerce"), newMethod(vm, TrFloat_coerce, TR_NIL, 1));
+}
@@ -0,0 +1,283 @@
+import (
+	"fmt";
+	"math/big";
+	"reflect";
+	"strings";
+	"unicode";
+	"tr";
+)
+
+// Methods written as ordinary Go funcs. Their arguments are converted to the types of the
+// parameters of the func and their results back to Ruby objects, with an error result raised as
+// a RuntimeError. A *RubyVM parameter, first or right after the receiver, is passed the VM and
+// isn't an argument of the method.
+
+var (
+	value_type = reflect.TypeOf(Value{});
+	vm_type = reflect.TypeOf((*RubyVM)(nil));
+	error_type = reflect.TypeOf((*error)(nil)).Elem();
+)
+
+// An object of a class defined with DefineStruct, wrapping a pointer to a Go struct.
+type GoObject struct {
+	type			TR_T;
+	class			*RubyObject;
+	ivars			map[string] RubyObject;
+	value			reflect.Value;
+}
+
+// Returns a method calling fn, which is passed the receiver first if receiver is set.
+func newGoMethod(vm *RubyVM, fn interface{}, receiver bool) (RubyObject, error) {
+	f := reflect.ValueOf(fn);
+	if f.Kind() != reflect.Func { return nil, fmt.Errorf("tinyrb: expected a func, got %T", fn); }
+	t := f.Type();
+	params := go_params(t, receiver);
+	if t.NumIn() < params { return nil, fmt.Errorf("tinyrb: %s has no receiver parameter", t); }
+	if t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != error_type) {
+		return nil, fmt.Errorf("tinyrb: %s must return at most a value and an error", t);
+	}
+	arity := t.NumIn() - params;
+	// the variadic parameter takes any number of args, none included
+	if t.IsVariadic() { arity = -arity; }
+	m := Method *(newMethod(vm, nil, TR_NIL, arity));
+	m.gofunc = f;
+	m.go_receiver = receiver;
+	return m, nil;
+}
+
+// Returns the number of parameters of a func of type t that aren't arguments of the method.
+func go_params(t reflect.Type, receiver bool) int {
+	n := 0;
+	if receiver { n++; }
+	if t.NumIn() > n && t.In(n) == vm_type { n++; }
+	return n;
+}
+
+// Calls the Go func of the method with the args converted, see newGoMethod. Method.call checked
+// their number already.
+func (self *Method) call_go(vm *RubyVM, receiver *RubyObject, args []RubyObject) (result RubyObject) {
+	t := self.gofunc.Type();
+	params := go_params(t, self.go_receiver);
+	in := make([]reflect.Value, 0, params + len(args));
+	if self.go_receiver {
+		v, err := vm.to_go(receiver, t.In(0));
+		if err != nil { return vm.raise(vm.cTypeError, "%s", err); }
+		in = append(in, v);
+	}
+	if params > len(in) { in = append(in, reflect.ValueOf(vm)); }
+	for n := 0; n < len(args); n++ {
+		i := params + n;
+		if t.IsVariadic() && i >= t.NumIn() - 1 {
+			param := t.In(t.NumIn() - 1).Elem();
+		} else {
+			param := t.In(i);
+		}
+		v, err := vm.to_go(args[n], param);
+		if err != nil { return vm.raise(vm.cTypeError, "%s", err); }
+		in = append(in, v);
+	}
+
+	// a panic in the func is raised like an error it would return
+	defer func() {
+		if err := recover(); err != nil { result = vm.raise(vm.cRuntimeError, "%v", err); }
+	}();
+	out := self.gofunc.Call(in);
+
+	if len(out) > 0 && t.Out(len(out) - 1) == error_type {
+		if err := out[len(out) - 1]; !err.IsNil() { return vm.raise_go_error(err.Interface().(error)); }
+		out = out[:len(out) - 1];
+	}
+	if len(out) == 0 { return TR_NIL; }
+	v, err := vm.ValueOf(out[0].Interface());
+	if err != nil { return vm.raise(vm.cTypeError, "%s", err); }
+	return v.obj;
+}
+
+func (vm *RubyVM) raise(class *RubyObject, format string, args ...interface{}) RubyObject {
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	vm.throw_value = TrException_new(vm, class, TrString_new2(vm, fmt.Sprintf(format, args...)));
+	return TR_UNDEF;
+}
+
+// Raises an error returned by a Go func, a *RubyError from calling back into the VM raises the
+// exception it holds again. Any other error is kept for the RubyError the exception ends up as.
+func (vm *RubyVM) raise_go_error(err error) RubyObject {
+	if vm.go_errors == nil { vm.go_errors = make(map[RubyObject] error); }
+	if e, ok := err.(*RubyError); ok && e.Exception.vm == vm {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = e.Exception.obj;
+		if e.Err != nil { vm.go_errors[e.Exception.obj] = e.Err; }
+		return TR_UNDEF;
+	}
+	vm.raise(vm.cRuntimeError, "%s", err);
+	vm.go_errors[vm.throw_value] = err;
+	return TR_UNDEF;
+}
+
+// Returns the Ruby name of what a Go type holds, for conversion errors.
+func (vm *RubyVM) ruby_type_name(t reflect.Type) string {
+	if class, ok := vm.go_types[t]; ok { return Class *(class).name.ptr; }
+	switch t.Kind() {
+		case reflect.Bool: return "true or false";
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr: return "Integer";
+		case reflect.Float32, reflect.Float64: return "Float";
+		case reflect.String: return "String";
+		case reflect.Slice, reflect.Array: return "Array";
+		case reflect.Map: return "Hash";
+	}
+	if t == reflect.TypeOf((*big.Int)(nil)) { return "Integer"; }
+	return t.String();
+}
+
+// Converts obj to a value of type t.
+func (vm *RubyVM) to_go(obj RubyObject, t reflect.Type) (reflect.Value, error) {
+	v := vm.wrap(obj);
+	fail := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("can't convert %s into %s", v.Class(), vm.ruby_type_name(t));
+	};
+	switch {
+		case t == value_type:
+			return reflect.ValueOf(v), nil;
+		case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+			if x := v.Interface(); x != nil { return reflect.ValueOf(x), nil; }
+			return reflect.Zero(t), nil;
+		case t == reflect.TypeOf((*big.Int)(nil)):
+			if n := TrInteger_to_big(obj); n != nil { return reflect.ValueOf(new(big.Int).Set(n)), nil; }
+			return fail();
+		case t == reflect.TypeOf([]byte(nil)):
+			if s, err := v.AsString(); err == nil { return reflect.ValueOf([]byte(s)), nil; }
+			return fail();
+	}
+	if _, ok := vm.go_types[t]; ok {
+		if !TR_IMMEDIATE(obj) && obj.(GoObject) && GoObject *(obj).value.Type() == t { return GoObject *(obj).value, nil; }
+		return fail();
+	}
+
+	x := reflect.New(t).Elem();
+	switch t.Kind() {
+		case reflect.Bool:
+			x.SetBool(obj != TR_NIL && obj != TR_FALSE);
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n := TrInteger_to_big(obj);
+			if n == nil { return fail(); }
+			if !n.IsInt64() || x.OverflowInt(n.Int64()) { return reflect.Value{}, fmt.Errorf("%s out of range of %s", n, t); }
+			x.SetInt(n.Int64());
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n := TrInteger_to_big(obj);
+			if n == nil { return fail(); }
+			if !n.IsUint64() || x.OverflowUint(n.Uint64()) { return reflect.Value{}, fmt.Errorf("%s out of range of %s", n, t); }
+			x.SetUint(n.Uint64());
+		case reflect.Float32, reflect.Float64:
+			f, err := v.AsFloat();
+			if err != nil { return fail(); }
+			x.SetFloat(f);
+		case reflect.String:
+			s, err := v.AsString();
+			if err != nil { return fail(); }
+			x.SetString(s);
+		case reflect.Slice:
+			items, err := v.AsSlice();
+			if err != nil { return fail(); }
+			x.Set(reflect.MakeSlice(t, len(items), len(items)));
+			for n, item := range items {
+				e, err := vm.to_go(item.obj, t.Elem());
+				if err != nil { return reflect.Value{}, err; }
+				x.Index(n).Set(e);
+			}
+		case reflect.Map:
+			pairs, err := v.AsMap();
+			if err != nil { return fail(); }
+			x.Set(reflect.MakeMap(t));
+			for key, value := range pairs {
+				k, err := vm.to_go(key.obj, t.Key());
+				if err != nil { return reflect.Value{}, err; }
+				e, err := vm.to_go(value.obj, t.Elem());
+				if err != nil { return reflect.Value{}, err; }
+				x.SetMapIndex(k, e);
+			}
+		default:
+			return fail();
+	}
+	return x, nil;
+}
+
+// Defines a method of Object calling fn, which isn't passed the receiver. See newGoMethod.
+func (vm *RubyVM) DefineFunction(name string, fn interface{}) error {
+	m, err := newGoMethod(vm, fn, false);
+	if err != nil { return err; }
+	vm.classes[TR_T_Object].add_method(vm, TrSymbol_new(vm, name), m);
+	return nil;
+}
+
+// Returns the top level class name, created as a subclass of super if it doesn't exist yet. super
+// can be the zero Value for Object.
+func (vm *RubyVM) DefineClass(name string, super Value) (Value, error) {
+	sym := TrSymbol_new(vm, name);
+	if class, ok := vm.consts[sym]; ok {
+		if TR_IMMEDIATE(class) || !class.(Class) { return Value{}, fmt.Errorf("tinyrb: %s is not a class", name); }
+		return vm.wrap(class), nil;
+	}
+	if super.vm == nil { super = vm.wrap(vm.classes[TR_T_Object]); }
+	if TR_IMMEDIATE(super.obj) || !super.obj.(Class) { return Value{}, fmt.Errorf("tinyrb: superclass must be a Class, got %s", super.Class()); }
+	class := newClass(vm, sym, super.obj);
+	Object_const_set(vm, vm.self, sym, class);
+	return vm.wrap(class), nil;
+}
+
+// Defines an instance method of the class or module v calling fn, which is passed the receiver
+// first, as a Value or as the pointer wrapped by an object of DefineStruct.
+func (v Value) DefineMethod(name string, fn interface{}) error {
+	if v.vm == nil || TR_IMMEDIATE(v.obj) || (!v.obj.(Class) && !v.obj.(Module)) { return fmt.Errorf("tinyrb: can't define a method on %s", v.Inspect()); }
+	m, err := newGoMethod(v.vm, fn, true);
+	if err != nil { return err; }
+	Class *(v.obj).add_method(v.vm, TrSymbol_new(v.vm, name), m);
+	return nil;
+}
+
+// Defines a singleton method of v, like a class method, calling fn like DefineMethod.
+func (v Value) DefineSingletonMethod(name string, fn interface{}) error {
+	if v.vm == nil || TR_IMMEDIATE(v.obj) || (!v.obj.(Class) && !v.obj.(Module)) { return fmt.Errorf("tinyrb: can't define a singleton method on %s", v.Inspect()); }
+	m, err := newGoMethod(v.vm, fn, true);
+	if err != nil { return err; }
+	Object_add_singleton_method(v.vm, v.obj, TrSymbol_new(v.vm, name), m);
+	return nil;
+}
+
+// Returns a Go method name in snake case, like Ruby method names: AddAll is add_all.
+func snake_case(name string) string {
+	runes := []rune(name);
+	s := make([]rune, 0, len(runes) + 4);
+	for n, r := range runes {
+		if unicode.IsUpper(r) && n > 0 && (!unicode.IsUpper(runes[n - 1]) || (n + 1 < len(runes) && unicode.IsLower(runes[n + 1]))) {
+			s = append(s, '_');
+		}
+		s = append(s, unicode.ToLower(r));
+	}
+	return string(s);
+}
+
+// Defines a top level class whose objects wrap a pointer to a Go struct, of the type of prototype
+// like (*Counter)(nil). The exported methods of the pointer type are its methods, in snake case,
+// Initialize being called by new. ValueOf wraps pointers of this type in objects of the class.
+func (vm *RubyVM) DefineStruct(name string, prototype interface{}) (Value, error) {
+	t := reflect.TypeOf(prototype);
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return Value{}, fmt.Errorf("tinyrb: expected a pointer to a struct, got %T", prototype);
+	}
+	if _, ok := vm.go_types[t]; ok { return Value{}, fmt.Errorf("tinyrb: %s is already defined", t); }
+	class, err := vm.DefineClass(name, Value{});
+	if err != nil { return Value{}, err; }
+
+	// subclasses allocate objects of their own class, wrapping the same type
+	err = class.DefineSingletonMethod("allocate", func(c Value) Value {
+		return vm.wrap(GoObject{type: TR_T_Object, class: c.obj, ivars: make(map[string] RubyObject), value: reflect.New(t.Elem())});
+	});
+	if err != nil { return Value{}, err; }
+	for n := 0; n < t.NumMethod(); n++ {
+		m := t.Method(n);
+		if err := class.DefineMethod(snake_case(m.Name), m.Func.Interface()); err != nil { return Value{}, err; }
+	}
+	if vm.go_types == nil { vm.go_types = make(map[reflect.Type] RubyObject); }
+	vm.go_types[t] = class.obj;
+	return class, nil;
+}
@@ -0,0 +1,155 @@
+package RubyVM
+
+import (
+	"errors";
+	"fmt";
+	"strings";
+	"testing";
+)
+
+func expect_error(t *testing.T, vm *RubyVM, src, class, message string) {
+	_, err := vm.Eval(src, "(test)");
+	var e *RubyError;
+	if !errors.As(err, &e) { t.Errorf("%q: expected %s, got %v", src, class, err); return; }
+	if e.Class != class || !strings.Contains(e.Message, message) { t.Errorf("%q: expected %s: %s, got %s", src, class, message, e); }
+}
+
+func TestDefineFunctionArguments(t *testing.T) {
+	vm := newTestVM(t);
+	vm.DefineFunction("repeat", func(s string, n int) string { return strings.Repeat(s, n); });
+	vm.DefineFunction("total", func(values []float64) float64 {
+		sum := 0.0;
+		for _, v := range values { sum += v; }
+		return sum;
+	});
+	vm.DefineFunction("count", func(counts map[string]int, key string) int { return counts[key]; });
+	vm.DefineFunction("join", func(sep string, parts ...string) string { return strings.Join(parts, sep); });
+	vm.DefineFunction("debug_level", func(vm *RubyVM) int { return vm.debug; });
+	vm.DefineFunction("nothing", func() {});
+
+	tests := []struct {
+		src string;
+		expected interface{};
+	}{
+		{"repeat('ab', 3)", "ababab"},
+		{"repeat(:ab, 1)", "ab"},
+		{"total([1, 2.5])", 3.5},
+		{"count({ 'a' => 2 }, 'a')", 2},
+		{"join('-')", ""},
+		{"join('-', 'a', 'b', 'c')", "a-b-c"},
+		{"debug_level", 0},
+		{"nothing", nil},
+	};
+	for _, test := range tests {
+		if v := eval(t, vm, test.src).Interface(); fmt.Sprint(v) != fmt.Sprint(test.expected) { t.Errorf("%s = %#v, expected %#v", test.src, v, test.expected); }
+	}
+	expect_error(t, vm, "repeat('ab')", "ArgumentError", "");
+	expect_error(t, vm, "repeat('ab', 'three')", "TypeError", "can't convert String into Integer");
+	expect_error(t, vm, "total([1, 'two'])", "TypeError", "can't convert String into Float");
+	expect_error(t, vm, "repeat('ab', 1180591620717411303424)", "TypeError", "out of range");
+}
+
+func TestDefineFunctionInvalid(t *testing.T) {
+	vm := newTestVM(t);
+	if err := vm.DefineFunction("f", 42); err == nil { t.Errorf("only funcs can be methods"); }
+	if err := vm.DefineFunction("f", func() (int, int) { return 1, 2; }); err == nil { t.Errorf("a second result must be an error"); }
+	if err := (Value{}).DefineMethod("f", func(self Value) {}); err == nil { t.Errorf("the zero Value has no methods"); }
+	if err := eval(t, vm, "1").DefineMethod("f", func(self Value) {}); err == nil { t.Errorf("methods are defined on classes"); }
+	if err := eval(t, vm, "Object").DefineMethod("f", func() {}); err == nil { t.Errorf("a method needs a receiver parameter"); }
+}
+
+func TestDefineFunctionErrors(t *testing.T) {
+	vm := newTestVM(t);
+	vm.DefineFunction("parse", func(s string) (int, error) {
+		if s == "" { return 0, errors.New("empty string"); }
+		return len(s), nil;
+	});
+	vm.DefineFunction("explode", func() int { panic("boom"); });
+	vm.DefineFunction("call_ruby", func(vm *RubyVM, src string) (Value, error) { return vm.Eval(src, "(nested)"); });
+
+	if v := eval(t, vm, "parse('abc')"); v.Interface() != 3 { t.Errorf("parse('abc') = %v", v); }
+	expect_error(t, vm, "parse('')", "RuntimeError", "empty string");
+	if v := eval(t, vm, "begin\n  parse('')\nrescue => e\n  e.message\nend\n"); v.String() != "empty string" {
+		t.Errorf("Ruby code should rescue the error, got %v", v);
+	}
+	expect_error(t, vm, "explode", "RuntimeError", "boom");
+	if v := eval(t, vm, "1 + 1"); v.Interface() != 2 { t.Errorf("the VM should go on after a panic"); }
+	// an exception raised by Ruby code called back from Go keeps its class
+	expect_error(t, vm, "call_ruby('raise ArgumentError, \"nested\"')", "ArgumentError", "nested");
+}
+
+func TestDefineMethod(t *testing.T) {
+	vm := newTestVM(t);
+	shape, err := vm.DefineClass("Shape", Value{});
+	if err != nil { t.Fatal(err); }
+	if again, err := vm.DefineClass("Shape", Value{}); err != nil || again != shape { t.Errorf("DefineClass should return the existing class"); }
+	eval(t, vm, "module Mixin; end");
+	if _, err := vm.DefineClass("Mixin", Value{}); err == nil { t.Errorf("Mixin isn't a class"); }
+	square, err := vm.DefineClass("Square", shape);
+	if err != nil { t.Fatal(err); }
+	square.DefineMethod("area", func(self Value) (int, error) {
+		side, err := self.Call("side");
+		if err != nil { return 0, err; }
+		n, err := side.AsInt();
+		return n * n, err;
+	});
+	shape.DefineSingletonMethod("kind", func(self Value) string { return "shape " + self.Inspect(); });
+
+	eval(t, vm, "class Square\n  def side\n    3\n  end\nend\n");
+	if v := eval(t, vm, "Square.new.area"); v.Interface() != 9 { t.Errorf("Square.new.area = %v", v); }
+	if v := eval(t, vm, "Square.superclass"); v.Inspect() != "Shape" { t.Errorf("the superclass of Square should be Shape, got %v", v); }
+	if v := eval(t, vm, "Shape.kind"); v.String() != "shape Shape" { t.Errorf("Shape.kind = %v", v); }
+
+	// redefining a method in Ruby replaces the Go one, even at call sites that already called it
+	eval(t, vm, "def area_of(s)\n  s.area\nend\narea_of(Square.new)\n");
+	eval(t, vm, "class Square\n  def area\n    0\n  end\nend\n");
+	if v := eval(t, vm, "area_of(Square.new)"); v.Interface() != 0 { t.Errorf("the Ruby method should be called, got %v", v); }
+}
+
+type Counter struct {
+	count, step int;
+}
+
+func (c *Counter) Initialize(step int) { c.step = step; }
+
+func (c *Counter) Increment() int {
+	c.count += c.step;
+	return c.count;
+}
+
+func (c *Counter) AddAll(counts []int) int {
+	for _, n := range counts { c.count += n; }
+	return c.count;
+}
+
+func (c *Counter) Merge(other *Counter) *Counter {
+	c.count += other.count;
+	return c;
+}
+
+func TestDefineStruct(t *testing.T) {
+	vm := newTestVM(t);
+	if _, err := vm.DefineStruct("Counter", Counter{}); err == nil { t.Errorf("a struct isn't a pointer to a struct"); }
+	if _, err := vm.DefineStruct("Counter", (*Counter)(nil)); err != nil { t.Fatal(err); }
+	if _, err := vm.DefineStruct("Other", (*Counter)(nil)); err == nil { t.Errorf("a type can be defined once only"); }
+
+	// new allocates a *Counter and calls Initialize
+	v := eval(t, vm, "c = Counter.new(2)\nc.increment\nc.increment\nc");
+	c, ok := v.Interface().(*Counter);
+	if !ok || c.count != 4 || c.step != 2 { t.Fatalf("expected a *Counter counting to 4, got %#v", v.Interface()); }
+	if v := eval(t, vm, "c.add_all([1, 2])"); v.Interface() != 7 { t.Errorf("c.add_all([1, 2]) = %v", v); }
+	if v := eval(t, vm, "c.merge(Counter.new(1))"); v.Interface() != c || c.count != 8 { t.Errorf("merge should return the same *Counter, got %#v", v.Interface()); }
+	expect_error(t, vm, "c.merge(1)", "TypeError", "can't convert Fixnum into Counter");
+	expect_error(t, vm, "Counter.new", "ArgumentError", "");
+
+	// ValueOf wraps a *Counter in a Counter, and subclasses wrap a *Counter too
+	if v, err := vm.ValueOf(&Counter{count: 10, step: 1}); err != nil || v.Class() != "Counter" { t.Errorf("ValueOf(&Counter{}): %v, %v", v, err); }
+	v = eval(t, vm, "class Fast < Counter\n  def twice\n    increment\n    increment\n  end\nend\nf = Fast.new(5)\nf.twice\nf");
+	if c, ok := v.Interface().(*Counter); v.Class() != "Fast" || !ok || c.count != 10 { t.Errorf("expected a Fast counting to 10, got %#v", v.Interface()); }
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{"Increment": "increment", "AddAll": "add_all", "ToJSON": "to_json", "HTTPServer": "http_server"} {
+		if s := snake_case(name); s != expected { t.Errorf("snake_case(%q) = %q, expected %q", name, s, expected); }
+	}
+}
@@ -14,7 +14,7 @@ func TrHash_new2(vm *RubyVM, n size_t, items []RubyObject) RubyObject {
 	return h;
 }
 
-func TrHash_size(vm *RubyVM, self *RubyObject) RubyObject {
+func TrHash_size(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	if !self.(Hash) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Hash"));
@@ -24,7 +24,8 @@ func TrHash_size(vm *RubyVM, self *RubyObject) RubyObject {
 }
 
 // TODO use Object#hash as the key
-func TrHash_get(vm *RubyVM, self, key *RubyObject) RubyObject {
+func TrHash_get(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	key := args[0];
 	if !self.(Hash) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Hash"));
@@ -33,7 +34,8 @@ func TrHash_get(vm *RubyVM, self, key *RubyObject) RubyObject {
 	return self.hash[key] || TR_NIL;
 }
 
-func TrHash_set(vm *RubyVM, self, key, value *RubyObject) RubyObject {
+func TrHash_set(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	key, value := args[0], args[1];
 	if !self.(Hash) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Hash"));
@@ -43,7 +45,8 @@ func TrHash_set(vm *RubyVM, self, key, value *RubyObject) RubyObject {
 	return value;
 }
 
-func TrHash_delete(vm *RubyVM, self, key *RubyObject) RubyObject {
+func TrHash_delete(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	key := args[0];
 	if !self.(Hash) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Hash"));
@@ -59,9 +62,9 @@ func TrHash_delete(vm *RubyVM, self, key *RubyObject) RubyObject {
 
 func TrHash_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Hash] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Hash), newClass(vm, TrSymbol_new(vm, Hash), vm.classes[TR_T_Object]));
-	c.add_method(vm, TrSymbol_new(vm, "length"), newMethod(vm, (TrFunc *)TrHash_size, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "size"), newMethod(vm, (TrFunc *)TrHash_size, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "[]"), newMethod(vm, (TrFunc *)TrHash_get, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "[]="), newMethod(vm, (TrFunc *)TrHash_set, TR_NIL, 2));
-	c.add_method(vm, TrSymbol_new(vm, "delete"), newMethod(vm, (TrFunc *)TrHash_delete, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "length"), newMethod(vm, TrHash_size, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "size"), newMethod(vm, TrHash_size, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "[]"), newMethod(vm, TrHash_get, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "[]="), newMethod(vm, TrHash_set, TR_NIL, 2));
+	c.add_method(vm, TrSymbol_new(vm, "delete"), newMethod(vm, TrHash_delete, TR_NIL, 1));
 }
\ No newline at end of file
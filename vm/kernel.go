@@ -1,4 +1,6 @@
 import(
+	"fmt";
+	"path";
 	"tr";
 	)
 
@@ -10,55 +12,55 @@ func TrBinding_init(vm *RubyVM) {
 	vm.classes[TR_T_Binding] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Binding), newClass(vm, TrSymbol_new(vm, Binding), vm.classes[TR_T_Object]));
 }
 
-func TrKernel_puts(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) RubyObject {
+func TrKernel_puts(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	object_as_string := Object_send(vm, object, 1, { TrSymbol_new(vm, "to_s") });
 	if !object_as_string.(String) && !object_as_string.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + object_as_string));
 		return TR_UNDEF;
 	}
-	for object := range argv { fmt.println("%s", object_as_string.ptr); }
+	for object := range args { fmt.Fprintf(vm.out, "%s\n", object_as_string.ptr); }
 	return TR_NIL;
 }
 
-func TrKernel_binding(vm *RubyVM, self RubyObject) RubyObject {
+func TrKernel_binding(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	return TrBinding_new(vm, vm.frame.previous);
 }
 
-func TrKernel_eval(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) RubyObject {
-	if argc < 1 {
+func TrKernel_eval(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if len(args) < 1 {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "string argument required"));
 		return TR_UNDEF;
 	}
-	if argc > 4 {
+	if len(args) > 4 {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "Too many arguments"));
 		return TR_UNDEF;
 	}
-	code_string := argv[0];
-	if argc > 1 && argv[1] {
-		if !argv[1].(Binding) {
+	code_string := args[0];
+	if len(args) > 1 && args[1] {
+		if !args[1].(Binding) {
 			vm.throw_reason = TR_THROW_EXCEPTION;
 			vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Binding"));
 			return TR_UNDEF;
 		}
-		frame := TrBinding *(argv[1]);
+		frame := TrBinding *(args[1]);
 	} else {
 		frame := vm.frame;
 	}
-	if argc > 2 && argv[1] {
-		if !argv[2].(String) && !argv[2].(Symbol) {
+	if len(args) > 2 && args[1] {
+		if !args[2].(String) && !args[2].(Symbol) {
 			vm.throw_reason = TR_THROW_EXCEPTION;
-			vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + argv[2]));
+			vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + args[2]));
 			return TR_UNDEF;
 		}		
-		filename := argv[2].ptr;
+		filename := args[2].ptr;
 	} else {
 		filename := "<eval>";
 	}
-	if argc > 3 {
-		lineno := TR_FIX2INIT(argv[3]);
+	if len(args) > 3 {
+		lineno := TR_FIX2INIT(args[3]);
 	} else {
 		lineno := 0;
 	}
@@ -69,41 +71,85 @@ func TrKernel_eval(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) Ru
 	}
 	blk := Block_compile(vm, code_string.ptr, filename, lineno);
 	if !blk { return TR_UNDEF }
-	if vm.debug { blk.dump2(vm, 0) }
+	if vm.debug { blk.dump(vm, 0) }
 	return vm.run(blk, frame.self, frame.class, frame.stack[0:blk.locals.Len() - 1]);
 }
 
-func TrKernel_load(vm *RubyVM, self, filename *RubyObject) RubyObject {
+func TrKernel_load(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	filename := args[0];
 	if !filename.(String) && !filename.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + filename));
 		return TR_UNDEF;
 	}
-	return vm.load(filename.ptr);
+	// unlike require, load runs the file every time and doesn't infer the extension
+	if file_exists(filename.ptr) { return vm.load(filename.ptr); }
+	found := vm.resolve_feature(filename.ptr, false);
+	if found == "" { return vm.load_error(filename.ptr); }
+	return vm.load(found);
 }
 
-func TrKernel_raise(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) RubyObject {
+func TrKernel_require(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	name := args[0];
+	if TR_IMMEDIATE(name) || !name.(String) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "can't convert %s into String", Class *(Object_class(vm, name)).name.ptr));
+		return TR_UNDEF;
+	}
+	found := vm.resolve_feature(name.ptr, true);
+	if found == "" { return vm.load_error(name.ptr); }
+	return vm.require(found);
+}
+
+// Requires name relative to the directory of the file calling it.
+func TrKernel_require_relative(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	name := args[0];
+	if TR_IMMEDIATE(name) || !name.(String) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, tr_sprintf(vm, "can't convert %s into String", Class *(Object_class(vm, name)).name.ptr));
+		return TR_UNDEF;
+	}
+	filename := vm.current_filename();
+	if filename == TR_NIL {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cLoadError, tr_sprintf(vm, "cannot infer basepath"));
+		return TR_UNDEF;
+	}
+	found := resolve_in(path.Dir(absolute_path(filename.ptr)), name.ptr, true);
+	if found == "" { return vm.load_error(name.ptr); }
+	return vm.require(found);
+}
+
+// Returns the absolute directory of the file calling it.
+func TrKernel_dir(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	filename := vm.current_filename();
+	if filename == TR_NIL { return TR_NIL; }
+	return TrString_new2(vm, path.Dir(absolute_path(filename.ptr)));
+}
+
+func TrKernel_raise(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	e := TR_NIL;
-	switch (argc) {
+	switch (len(args)) {
 		case 0:
 			e = vm.globals[TrSymbol_new(vm, "$!")] || TR_NIL;
 
 		case 1:
-			if argv[0].(String) {
-				e = TrException_new(vm, vm.cRuntimeError, argv[0]);
+			if args[0].(String) {
+				e = TrException_new(vm, vm.cRuntimeError, args[0]);
 			} else {
-				e = Object_send(vm, argv[0], 1, { TrSymbol_new(vm, "exception") });
+				e = Object_send(vm, args[0], 1, { TrSymbol_new(vm, "exception") });
 			}
 
 		case 2:
-			e = Object_send(vm, argv[0], 1, { TrSymbol_new(vm, "exception") });
+			e = Object_send(vm, args[0], 2, { TrSymbol_new(vm, "exception"), args[1] });
 
 		default:
 			vm.throw_reason = TR_THROW_EXCEPTION;
-			vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "wrong number of arguments (%d for 2)", argc));
+			vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "wrong number of arguments (%d for 2)", len(args)));
 			return TR_UNDEF;			
 	}
-	TrException_set_backtrace(vm, e, vm.backtrace());
+	// re-raising $! keeps the backtrace of where it was first raised
+	if len(args) > 0 { TrException_set_backtrace(vm, e, { vm.backtrace() }, nil); }
 	vm.throw_reason = TR_THROW_EXCEPTION;
 	vm.throw_value = e;
 	return TR_UNDEF;
@@ -112,9 +158,14 @@ func TrKernel_raise(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) R
 func TrKernel_init(vm *RubyVM) {
 	m := Object_const_set(vm, vm.self, TrSymbol_new(vm, "Kernel"), vm.newModule(TrSymbol_new(vm, "Kernel")));
 	vm.classes[TR_T_Object].include(vm, m);
-	c.add_method(vm, TrSymbol_new(vm, "puts"), newMethod(vm, (TrFunc *)TrKernel_puts, TR_NIL, -1));
-	c.add_method(vm, TrSymbol_new(vm, "eval"), newMethod(vm, (TrFunc *)TrKernel_eval, TR_NIL, -1));
-	c.add_method(vm, TrSymbol_new(vm, "load"), newMethod(vm, (TrFunc *)TrKernel_load, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "binding"), newMethod(vm, (TrFunc *)TrKernel_binding, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "raise"), newMethod(vm, (TrFunc *)TrKernel_raise, TR_NIL, -1));
+	m.add_method(vm, TrSymbol_new(vm, "puts"), newMethod(vm, TrKernel_puts, TR_NIL, -1));
+	m.add_method(vm, TrSymbol_new(vm, "eval"), newMethod(vm, TrKernel_eval, TR_NIL, -1));
+	m.add_method(vm, TrSymbol_new(vm, "load"), newMethod(vm, TrKernel_load, TR_NIL, 1));
+	m.add_method(vm, TrSymbol_new(vm, "require"), newMethod(vm, TrKernel_require, TR_NIL, 1));
+	m.add_method(vm, TrSymbol_new(vm, "require_relative"), newMethod(vm, TrKernel_require_relative, TR_NIL, 1));
+	m.add_method(vm, TrSymbol_new(vm, "__dir__"), newMethod(vm, TrKernel_dir, TR_NIL, 0));
+	m.add_method(vm, TrSymbol_new(vm, "binding"), newMethod(vm, TrKernel_binding, TR_NIL, 0));
+	m.add_method(vm, TrSymbol_new(vm, "raise"), newMethod(vm, TrKernel_raise, TR_NIL, -1));
+	m.add_method(vm, TrSymbol_new(vm, "proc"), newMethod(vm, TrProc_new, TR_NIL, 0));
+	m.add_method(vm, TrSymbol_new(vm, "lambda"), newMethod(vm, TrProc_lambda, TR_NIL, 0));
 }
\ No newline at end of file
@@ -1,86 +1,132 @@
 import(
 	"tr";
+	"math/big";
 )
 
-func TrFixnum_add(vm *RunyVM, self, other *RubyObject) RubyObject {
-	return TR_INT2FIX(TR_FIX2INT(self) + TR_FIX2INT(other));
+// Returns n as a Fixnum, or as a Bignum if it doesn't fit.
+func TrInteger_new(vm *RubyVM, n int) RubyObject {
+	if n < TR_FIX_MIN || n > TR_FIX_MAX { return TrBignum_new(vm, big.NewInt(int64(n))); }
+	return TR_INT2FIX(n);
 }
 
-func TrFixnum_sub(vm *RubyVM, self, other *RubyObject) RubyObject {
-	return TR_INT2FIX(TR_FIX2INT(self) - TR_FIX2INT(other));
+func TrFixnum_zero_division(vm *RubyVM) RubyObject {
+	vm.throw_reason = TR_THROW_EXCEPTION;
+	vm.throw_value = TrException_new(vm, vm.cZeroDivisionError, tr_sprintf(vm, "divided by 0"));
+	return TR_UNDEF;
 }
 
-func TrFixnum_mul(vm *RubyVM, self, other *RubyObject) RubyObject {
-	return TR_INT2FIX(TR_FIX2INT(self) * TR_FIX2INT(other));
+// Operations on a Fixnum and something else than a Fixnum are done by Bignum, which hands
+// Floats and other numeric objects to TrInteger_coerce.
+
+func TrFixnum_add(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) { return TrInteger_new(vm, TR_FIX2INT(self) + TR_FIX2INT(other)); }
+	return TrBignum_add(vm, self, args, block);
 }
 
-func TrFixnum_div(vm *RubyVM, self, other *RubyObject) RubyObject {
-	return TR_INT2FIX(TR_FIX2INT(self) / TR_FIX2INT(other));
+func TrFixnum_sub(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) { return TrInteger_new(vm, TR_FIX2INT(self) - TR_FIX2INT(other)); }
+	return TrBignum_sub(vm, self, args, block);
 }
 
-func TrFixnum_eq(vm *RubyVM, self, other *RubyObject) RubyObject {
-	if TR_FIX2INT(self) == TR_FIX2INT(other) {
-		return TR_TRUE;
-	} else {
-		return TR_FALSE;
+func TrFixnum_mul(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) {
+		x, y := TR_FIX2INT(self), TR_FIX2INT(other);
+		r := x * y;
+		// the product of two Fixnums can overflow int itself
+		if x == 0 || (r / x == y && r >= TR_FIX_MIN && r <= TR_FIX_MAX) { return TR_INT2FIX(r); }
 	}
+	return TrBignum_mul(vm, self, args, block);
 }
 
-func TrFixnum_ne(vm *RubyVM, self, other *RubyObject) RubyObject {
-	if TR_FIX2INT(self) != TR_FIX2INT(other) {
-		return TR_TRUE;
-	} else {
-		return TR_FALSE;
-	}
+// Integer division rounds toward negative infinity.
+func TrFixnum_div(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if !TR_IS_FIX(other) { return TrBignum_div(vm, self, args, block); }
+	x, y := TR_FIX2INT(self), TR_FIX2INT(other);
+	if y == 0 { return TrFixnum_zero_division(vm); }
+	q := x / y;
+	if x % y != 0 && (x < 0) != (y < 0) { q--; }
+	return TrInteger_new(vm, q);
 }
 
-func TrFixnum_lt(vm *RubyVM, self, other *RubyObject) RubyObject {
-	if TR_FIX2INT(self) < TR_FIX2INT(other) {
-		return TR_TRUE;
-	} else {
-		return TR_FALSE;
-	}
+// The modulo has the sign of other.
+func TrFixnum_mod(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if !TR_IS_FIX(other) { return TrBignum_mod(vm, self, args, block); }
+	x, y := TR_FIX2INT(self), TR_FIX2INT(other);
+	if y == 0 { return TrFixnum_zero_division(vm); }
+	m := x % y;
+	if m != 0 && (m < 0) != (y < 0) { m += y; }
+	return TR_INT2FIX(m);
 }
 
-func TrFixnum_gt(vm *RubyVM, self, other *RubyObject) RubyObject {
-	if TR_FIX2INT(self) > TR_FIX2INT(other) {
-		return TR_TRUE;
-	} else {
-		return TR_FALSE;
-	}
+func TrFixnum_neg(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return TrInteger_new(vm, -TR_FIX2INT(self));
 }
 
-func TrFixnum_le(vm *RubyVM, self, other *RubyObject) RubyObject {
-	if TR_FIX2INT(self) <= TR_FIX2INT(other) {
-		return TR_TRUE;
-	} else {
-		return TR_FALSE;
-	}
+func TrFixnum_eq(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) { return TR_BOOL(TR_FIX2INT(self) == TR_FIX2INT(other)); }
+	return TrBignum_eq(vm, self, args, block);
 }
 
-func TrFixnum_ge(vm *RubyVM, self, other *RubyObject) RubyObject {
-	if TR_FIX2INT(self) >= TR_FIX2INT(other) {
-		return TR_TRUE;
-	} else {
-		return TR_FALSE;
-	}
+func TrFixnum_ne(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if TrFixnum_eq(vm, self, args, block) == TR_TRUE { return TR_FALSE; }
+	return TR_TRUE;
+}
+
+func TrFixnum_lt(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) { return TR_BOOL(TR_FIX2INT(self) < TR_FIX2INT(other)); }
+	return TrBignum_lt(vm, self, args, block);
 }
 
-func TrFixnum_to_s(vm *RubyVM, self *RubyObject) RubyObject {
+func TrFixnum_gt(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) { return TR_BOOL(TR_FIX2INT(self) > TR_FIX2INT(other)); }
+	return TrBignum_gt(vm, self, args, block);
+}
+
+func TrFixnum_le(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) { return TR_BOOL(TR_FIX2INT(self) <= TR_FIX2INT(other)); }
+	return TrBignum_le(vm, self, args, block);
+}
+
+func TrFixnum_ge(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
+	if TR_IS_FIX(other) { return TR_BOOL(TR_FIX2INT(self) >= TR_FIX2INT(other)); }
+	return TrBignum_ge(vm, self, args, block);
+}
+
+func TrFixnum_to_s(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	return tr_sprintf(vm, "%d", TR_FIX2INT(self));
 }
 
 void TrFixnum_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Fixnum] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Fixnum), newClass(vm, TrSymbol_new(vm, Fixnum), vm.classes[TR_T_Object]));
-	c.add_method(vm, TrSymbol_new(vm, "+"), newMethod(vm, (TrFunc *)TrFixnum_add, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "-"), newMethod(vm, (TrFunc *)TrFixnum_sub, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "*"), newMethod(vm, (TrFunc *)TrFixnum_mul, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "/"), newMethod(vm, (TrFunc *)TrFixnum_div, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "=="), newMethod(vm, (TrFunc *)TrFixnum_eq, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "!="), newMethod(vm, (TrFunc *)TrFixnum_eq, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "<"), newMethod(vm, (TrFunc *)TrFixnum_lt, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "<="), newMethod(vm, (TrFunc *)TrFixnum_le, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, ">"), newMethod(vm, (TrFunc *)TrFixnum_gt, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, ">="), newMethod(vm, (TrFunc *)TrFixnum_ge, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, (TrFunc *)TrFixnum_to_s, TR_NIL, 0));
-}
\ No newline at end of file
+	// methods the interpreter does itself when both operands are Fixnums, as long as they're not redefined
+	vm.fixnum_builtins = make(map[int] RubyObject);
+	vm.fixnum_builtins[TR_OP_ADD] = c.add_method(vm, TrSymbol_new(vm, "+"), newMethod(vm, TrFixnum_add, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_SUB] = c.add_method(vm, TrSymbol_new(vm, "-"), newMethod(vm, TrFixnum_sub, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_MUL] = c.add_method(vm, TrSymbol_new(vm, "*"), newMethod(vm, TrFixnum_mul, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_DIV] = c.add_method(vm, TrSymbol_new(vm, "/"), newMethod(vm, TrFixnum_div, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_MOD] = c.add_method(vm, TrSymbol_new(vm, "%"), newMethod(vm, TrFixnum_mod, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_EQ] = c.add_method(vm, TrSymbol_new(vm, "=="), newMethod(vm, TrFixnum_eq, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_LT] = c.add_method(vm, TrSymbol_new(vm, "<"), newMethod(vm, TrFixnum_lt, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_LE] = c.add_method(vm, TrSymbol_new(vm, "<="), newMethod(vm, TrFixnum_le, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_GT] = c.add_method(vm, TrSymbol_new(vm, ">"), newMethod(vm, TrFixnum_gt, TR_NIL, 1));
+	vm.fixnum_builtins[TR_OP_GE] = c.add_method(vm, TrSymbol_new(vm, ">="), newMethod(vm, TrFixnum_ge, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "!="), newMethod(vm, TrFixnum_ne, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "@-"), newMethod(vm, TrFixnum_neg, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrFixnum_to_s, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_f"), newMethod(vm, TrInteger_to_f, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_i"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "floor"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "ceil"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "round"), newMethod(vm, TrInteger_to_i, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "coerce"), newMethod(vm, TrInteger_coerce_pair, TR_NIL, 1));
+}
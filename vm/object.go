@@ -32,15 +32,15 @@ func Object_method(vm *RubyVM, self, name *RubyObject) RubyObject {
 	return class.instance_method(vm, name);
 }
 
-func Object_method_missing(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) RubyObject {
-	assert(argc > 0);
-	if !argv[0].(String) && !argv[0].(Symbol) {
+func TrObject_method_missing(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	assert(len(args) > 0);
+	if !args[0].(String) && !args[0].(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
-		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + argv[0]));
+		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + args[0]));
 		return TR_UNDEF;
 	}
 	vm.throw_reason = TR_THROW_EXCEPTION;
-	vm.throw_value = TrException_new(vm, vm.cNoMethodError, tr_sprintf(vm, "Method not found: `%s'", argv[0].ptr));
+	vm.throw_value = TrException_new(vm, vm.cNoMethodError, tr_sprintf(vm, "Method not found: `%s'", args[0].ptr));
 	return TR_UNDEF;
 }
 
@@ -59,13 +59,42 @@ func Object_send(vm *RubyVM, self *RubyObject, argc int, argv []RubyObject) Ruby
 	}
 }
 
-// TODO respect namespace
-func Object_const_get(vm *RubyVM, self, name *RubyObject) RubyObject {
-	return vm.consts[name] || TR_NIL;
+func Object_kind_of(vm *RubyVM, self, class *RubyObject) RubyObject {
+	if TR_IMMEDIATE(self) {
+		c := vm.classes[Object_type(vm, self)];
+	} else {
+		c := Object *(self).class;
+	}
+	while (c) {
+		// included modules are proxies in the ancestors
+		if c == class || Class *(c).origin == class { return TR_TRUE; }
+		c = Class *(c).super;
+	}
+	return TR_FALSE;
+}
+
+// Resolves a constant from the lexical scope cbase: first in cbase and the modules it's nested in,
+// then in the ancestors of cbase and at last at the top level. Calls cbase.const_missing if not found.
+func Object_const_get(vm *RubyVM, cbase, name *RubyObject) RubyObject {
+	if !cbase { cbase = vm.classes[TR_T_Object]; }
+	mod := cbase;
+	while (mod) {
+		if value, ok := Class *(mod).consts[name]; ok { return value; }
+		mod = Class *(mod).parent;
+	}
+	if value := cbase.find_const(vm, name); value != TR_UNDEF { return value; }
+	if value, ok := vm.consts[name]; ok { return value; }
+	return Object_send(vm, cbase, 2, { TrSymbol_new(vm, "const_missing"), name });
 }
 
+// Sets a constant in the module self. Constants set on anything else, like the top level object,
+// go in Object.
 func Object_const_set(vm *RubyVM, self, name, value *RubyObject) RubyObject {
-	vm.consts[name] = value;
+	if self && (self.(Class) || self.(Module)) {
+		Class *(self).consts[name] = value;
+	} else {
+		vm.consts[name] = value;
+	}
 	return value;
 }
 
@@ -99,18 +128,19 @@ func Object_class(vm *RubyVM, self *RubyObject) RubyObject {
 	return class;
 }
 
-func Object_object_id(vm *RubyVM, self *RubyObject) RubyObject {
+func TrObject_object_id(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	return TR_INT2FIX((int)&self);
 }
 
-func Object_instance_eval(vm *RubyVM, self, code *RubyObject) RubyObject {
+func TrObject_instance_eval(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	code := args[0];
 	if !code.(String) && !code.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + code));
 		return TR_UNDEF;
 	}
-	if block := Block_compile(vm, code.ptr, "<eval>", 0) {
-		return vm.run(block, self, Object *(self).class, nil);
+	if blk := Block_compile(vm, code.ptr, "<eval>", 0) {
+		return vm.run(blk, self, Object *(self).class, nil);
 	} else {
 		return TR_UNDEF;
 	}
@@ -126,18 +156,42 @@ func Object_inspect(vm *RubyVM, self *RubyObject) RubyObject {
 	return tr_sprintf(vm, "#<%s:%p>", class_name.ptr, self);
 }
 
+// Natives of the Object_ functions above, which are called directly from Go.
+
+func TrObject_class(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Object_class(vm, self);
+}
+
+func TrObject_method(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Object_method(vm, self, args[0]);
+}
+
+func TrObject_send(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Object_send(vm, self, len(args), args);
+}
+
+func TrObject_kind_of(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Object_kind_of(vm, self, args[0]);
+}
+
+func TrObject_inspect(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return Object_inspect(vm, self);
+}
+
 func Object_preinit(vm *RubyVM) {
 	return vm.classes[TR_T_Object] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Object), newClass(vm, TrSymbol_new(vm, Object), vm.classes[TR_T_Object]));
 }
 
 func Object_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Object];
-	c.add_method(vm, TrSymbol_new(vm, "class"), newMethod(vm, (TrFunc *)Object_class, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "method"), newMethod(vm, (TrFunc *)Object_method, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "method_missing"), newMethod(vm, (TrFunc *)Object_method_missing, TR_NIL, -1));
-	c.add_method(vm, TrSymbol_new(vm, "send"), newMethod(vm, (TrFunc *)Object_send, TR_NIL, -1));
-	c.add_method(vm, TrSymbol_new(vm, "object_id"), newMethod(vm, (TrFunc *)Object_object_id, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "instance_eval"), newMethod(vm, (TrFunc *)Object_instance_eval, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, (TrFunc *)Object_inspect, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "inspect"), newMethod(vm, (TrFunc *)Object_inspect, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "class"), newMethod(vm, TrObject_class, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "method"), newMethod(vm, TrObject_method, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "method_missing"), newMethod(vm, TrObject_method_missing, TR_NIL, -1));
+	c.add_method(vm, TrSymbol_new(vm, "send"), newMethod(vm, TrObject_send, TR_NIL, -1));
+	c.add_method(vm, TrSymbol_new(vm, "object_id"), newMethod(vm, TrObject_object_id, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "kind_of?"), newMethod(vm, TrObject_kind_of, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "is_a?"), newMethod(vm, TrObject_kind_of, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "instance_eval"), newMethod(vm, TrObject_instance_eval, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrObject_inspect, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "inspect"), newMethod(vm, TrObject_inspect, TR_NIL, 0));
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ const (
 	SIZE_B = 8;
 	SIZE_C = 8;
 	SIZE_Bx = SIZE_C + SIZE_B;
+	TR_CALL_BLOCK_PASS = 0xff;		// C of a CALL passing a Proc as block, m(&blk)
 	)
 
 /*
@@ -25,11 +26,12 @@ const (
   TR_OP_BOOL;       		// A B      R[A] = B + 1
   TR_OP_NIL;        		// A        R[A] = nil
   TR_OP_SELF;       		// A        put self in R[A]
-  TR_OP_LOOKUP;     		// A Bx     R[A+1] = lookup method K[Bx] on R[A] and store
-  TR_OP_CACHE;      		// A B C    if sites[C] matches R[A].type, jmp +B and next call will be on sites[C]
+  TR_OP_LOOKUP;     		// A Bx     R[A+1] = lookup method K[Bx] on R[A] and store in the sites of the previous CACHE
+  TR_OP_CACHE;      		// A Bx     if sites[Bx] holds the class of R[A], skip the LOOKUP and next call will be on the cached method
   TR_OP_CALL;       		/* A B C    call last looked up method on R[A] with B>>1 args starting at R[A+2],
                                 		if B & 1, splat last arg,
-                                		if C > 0 pass block[C-1] */
+                                		if C > 0 pass block[C-1],
+                                		if C == TR_CALL_BLOCK_PASS pass R[A+2+B>>1] as block */
   TR_OP_JMP;        		//   sBx    jump sBx instructions
   TR_OP_JMPIF;      		// A sBx    jump sBx instructions if R[A]
   TR_OP_JMPUNLESS;  		// A sBx    jump sBx instructions unless R[A]
@@ -39,7 +41,7 @@ const (
   TR_OP_GETUPVAL;   		// A B      R[A] = upvals[B]
   TR_OP_DEF;        		// A Bx     define method k[Bx] on self w/ blocks[A]
   TR_OP_METADEF;    		// A Bx     define method k[Bx] on R[nA] w/ blocks[A]
-  TR_OP_GETCONST;   		// A Bx     R[A] = Consts[k[Bx]]
+  TR_OP_GETCONST;   		// A Bx     R[A] = Consts[k[Bx]] looked up in the lexical scope
   TR_OP_SETCONST;   		// A Bx     Consts[k[Bx]] = R[A]
   TR_OP_CLASS;      		// A Bx     define class k[Bx] on self w/ blocks[A] and superclass R[nA]
   TR_OP_MODULE;     		// A Bx     define module k[Bx] on self w/ blocks[A]
@@ -58,7 +60,19 @@ const (
   TR_OP_LT;         		// A B C    R[A] = RK[B] < RK[C]
   TR_OP_NEG;        		// A B      R[A] = -RK[B]
   TR_OP_NOT;        		// A B      R[A] = !RK[B]
-  TR_OP_SUPER;    			// TODO
+  TR_OP_RESCUE;     		// A B      R[A+1] = R[A].kind_of?(any of R[A+2]..R[A+1+B]), StandardError if B is 0
+  TR_OP_RETHROW;    		// A        throw type=R[A+1] value=R[A] saved when entering an ensure handler
+  TR_OP_SUPER;      		// A Bx     lookup the method overridden by the current one, cached in sites[Bx], to be called on R[A] by the next CALL
+  TR_OP_GETSCOPE;   		// A Bx     R[A] = R[A]::k[Bx], top level constant if R[A] is nil
+  TR_OP_MUL;        		// A B C    R[A] = RK[B] * RK[C]
+  TR_OP_DIV;        		// A B C    R[A] = RK[B] / RK[C]
+  TR_OP_MOD;        		// A B C    R[A] = RK[B] % RK[C]
+  TR_OP_EQ;         		// A B C    R[A] = RK[B] == RK[C]
+  TR_OP_LE;         		// A B C    R[A] = RK[B] <= RK[C]
+  TR_OP_GT;         		// A B C    R[A] = RK[B] > RK[C]
+  TR_OP_GE;         		// A B C    R[A] = RK[B] >= RK[C]
+  TR_OP_DSTR;       		// A B C    R[A] = R[A].to_s + .. + R[A+B-1].to_s, as a Regexp if C
+  TR_OP_UNPACK;     		// A B C    R[A+1]..R[A+B] = elements of R[A].to_ary, R[A+C] gets the rest as an Array if C > 0
 )
 
 const OPCODE_NAMES = []string {
@@ -66,7 +80,9 @@ const OPCODE_NAMES = []string {
 	"cache",		"call",		"jmp",		"jmpif",	"jmpunless",	"return",	"throw",		"setupval",
 	"getupval",		"def",		"metadef",	"getconst",	"setconst",		"class",	"module",		"newarray",
 	"newhash",		"yield",	"getivar",	"setivar",	"getcvar",		"setcvar",	"getglobal",	"setglobal",
-	"newrange",		"add",		"sub",		"lt",		"neg",			"not",		"super"
+	"newrange",		"add",		"sub",		"lt",		"neg",			"not",		"rescue",		"rethrow",
+	"super",		"getscope",	"mul",		"div",		"mod",			"eq",		"le",			"gt",
+	"ge",			"dstr",		"unpack"
 }
 
 type MachineOP struct {
@@ -4,18 +4,130 @@ import (
 
 type Closure struct {
 	block			*Block;
-	upcals			*TrUpval;
+	upvals			[]*TrUpval;
 	self			*RubyObject;
 	class			*RubyObject;
 	parent			*Closure;
+	method			*Method;			// method the block was created in
+	cbase			*RubyObject;		// lexical scope for constant lookup
+	frame			*Frame;				// frame the block was created in, break leaves the call it's passed to there
 }
 
 func newClosure(vm *RubyVM, block *Block, self, class *RubyObject, parent *Closure) Closure {
 	closure = new(Closure);
 	closure.block = block;
-	closure.upvals = make([]TrUpval, block.upvals.Len());
+	closure.upvals = make([]*TrUpval, block.upvals.Len());
 	closure.self = self;
 	closure.class = class;
 	closure.parent = parent;
 	return closure;
-}
\ No newline at end of file
+}
+
+// Returns the open upvalue pointing to register reg, shared by all the closures capturing it.
+func (frame *Frame) upval(reg int) *TrUpval {
+	for upval := range frame.upvals.Iter() {
+		if upval.value == &frame.stack[reg] { return upval; }
+	}
+	upval := &TrUpval{value: &frame.stack[reg]};
+	frame.upvals.Push(upval);
+	return upval;
+}
+
+// Copies the values captured by closures out of the stack when the frame returns.
+func (frame *Frame) close_upvals() {
+	for upval := range frame.upvals.Iter() {
+		upval.closed = *upval.value;
+		upval.value = &upval.closed;
+	}
+	frame.upvals = Vector.New(0);
+}
+
+// proc
+
+type Proc struct {
+	type			TR_T;
+	class			*RubyObject;
+	ivars			map[string] RubyObject;
+	closure			*Closure;
+	lambda			bool;
+}
+
+func newProc(vm *RubyVM, closure *Closure, lambda bool) RubyObject {
+	return Proc{type: TR_T_Proc, class: vm.classes[TR_T_Proc], ivars: make(map[string] RubyObject), closure: closure, lambda: lambda};
+}
+
+func TrProc_new(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if !block {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "tried to create Proc object without a block"));
+		return TR_UNDEF;
+	}
+	return newProc(vm, block, false);
+}
+
+func TrProc_lambda(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if !block {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "tried to create Proc object without a block"));
+		return TR_UNDEF;
+	}
+	return newProc(vm, block, true);
+}
+
+func TrProc_call(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if !self.(Proc) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Proc"));
+		return TR_UNDEF;
+	}
+	proc := Proc *(self);
+	if proc.lambda {
+		min, max := proc.closure.block.arg_range();
+		if !vm.check_argc(len(args), min, max) { return TR_UNDEF; }
+	}
+	result := vm.call_closure(proc.closure, args);
+	// return and break inside a lambda only leave the lambda
+	if result == TR_UNDEF && proc.lambda && (vm.throw_reason == TR_THROW_RETURN || (vm.throw_reason == TR_THROW_BREAK && vm.break_target == proc.closure)) {
+		result = vm.throw_value;
+		vm.throw_reason = vm.throw_value = 0;
+	}
+	return result;
+}
+
+func TrProc_arity(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if !self.(Proc) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Proc"));
+		return TR_UNDEF;
+	}
+	b := Proc *(self).closure.block;
+	if b.arg_splat { return TR_INT2FIX(-b.argc); }
+	return TR_INT2FIX(b.argc);
+}
+
+func TrProc_to_proc(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	return self;
+}
+
+func TrProc_is_lambda(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	if !self.(Proc) {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Proc"));
+		return TR_UNDEF;
+	}
+	if Proc *(self).lambda {
+		return TR_TRUE;
+	} else {
+		return TR_FALSE;
+	}
+}
+
+func TrProc_init(vm *RubyVM) {
+	c := vm.classes[TR_T_Proc] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Proc), newClass(vm, TrSymbol_new(vm, Proc), vm.classes[TR_T_Object]));
+	Object_add_singleton_method(vm, c, TrSymbol_new(vm, "new"), newMethod(vm, TrProc_new, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "call"), newMethod(vm, TrProc_call, TR_NIL, -1));
+	c.add_method(vm, TrSymbol_new(vm, "[]"), newMethod(vm, TrProc_call, TR_NIL, -1));
+	c.add_method(vm, TrSymbol_new(vm, "arity"), newMethod(vm, TrProc_arity, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_proc"), newMethod(vm, TrProc_to_proc, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "lambda?"), newMethod(vm, TrProc_is_lambda, TR_NIL, 0));
+}
@@ -8,7 +8,7 @@ import (
 // Translate this to use Go's stdlib regexp package
 
 func TrRegexp_new(vm *RubyVM, pattern *string, options int) RubyObject {
-	r := Regexp{type: TR_T_Regexp, class: vm.classes[TR_T_Regexp], ivars: make(map[string] RubyObject)};
+	r := Regexp{type: TR_T_Regexp, class: vm.classes[TR_T_Regexp], ivars: make(map[string] RubyObject), source: pattern, options: options};
 	error *string;
 	erroffset int;
   
@@ -28,7 +28,8 @@ func TrRegexp_new(vm *RubyVM, pattern *string, options int) RubyObject {
 	return r;
 }
 
-func TrRegexp_compile(vm *RubyVM, self, pattern *RubyObject) RubyObject {
+func TrRegexp_compile(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	pattern := args[0];
 	if !pattern.(String) && !pattern.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + pattern));
@@ -39,7 +40,8 @@ func TrRegexp_compile(vm *RubyVM, self, pattern *RubyObject) RubyObject {
 
 #define OVECCOUNT 30    /* should be a multiple of 3 */
 
-func TrRegexp_match(vm *RubyVM, self, str *RubyObject) RubyObject {
+func TrRegexp_match(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	str := args[0];
 	if !self.(Regexp) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected Regexp"));
@@ -85,6 +87,15 @@ func TrRegexp_match(vm *RubyVM, self, str *RubyObject) RubyObject {
 	return data;
 }
 
+// Used by case/when, true if str is a String or Symbol matching the pattern.
+func TrRegexp_eqq(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	str := args[0];
+	if TR_IMMEDIATE(str) || (!str.(String) && !str.(Symbol)) { return TR_FALSE; }
+	data := TrRegexp_match(vm, self, args, block);
+	if data == TR_UNDEF { return TR_UNDEF; }
+	return TR_BOOL(data != TR_NIL);
+}
+
 func TrRegex_free(vm *RubyVM, self *RubyObject) {
 	r := TrRegexp *(self);
 	pcre_free(r.re);
@@ -92,6 +103,7 @@ func TrRegex_free(vm *RubyVM, self *RubyObject) {
 
 func TrRegexp_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Regexp] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Regexp), newClass(vm, TrSymbol_new(vm, Regexp), vm.classes[TR_T_Object]));
-	Object_add_singleton_method(vm, c, TrSymbol_new(vm, "new"), newMethod(vm, (TrFunc *)TrRegexp_compile, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "match"), newMethod(vm, (TrFunc *)TrRegexp_match, TR_NIL, 1));
+	Object_add_singleton_method(vm, c, TrSymbol_new(vm, "new"), newMethod(vm, TrRegexp_compile, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "match"), newMethod(vm, TrRegexp_match, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "==="), newMethod(vm, TrRegexp_eqq, TR_NIL, 1));
 }
\ No newline at end of file
@@ -0,0 +1,99 @@
+import (
+	"bufio";
+	"fmt";
+	"os";
+	"strings";
+	"tr";
+)
+
+const (
+	TR_REPL_PROMPT = "tinyrb> ";
+	TR_REPL_MORE = "tinyrb* ";			// prompt while an entry isn't complete
+	TR_REPL_FILENAME = "(tinyrb)";
+	)
+
+// An interactive session. Entries are evaluated at the top level, in a Binding keeping the locals
+// they define for the following ones.
+type Repl struct {
+	vm			*RubyVM;
+	binding		*TrBinding;
+	line		int;				// lines read so far, so errors point to the line of the session
+}
+
+func newRepl(vm *RubyVM) *Repl {
+	if TR_IMMEDIATE(vm.self) {
+		class := vm.classes[Object_type(vm, (vm.self))];
+	} else {
+		class := Object *(vm.self).class;
+	}
+	frame := vm.newFrame(vm.self, class, nil);
+	frame.cbase = class;
+	binding := TrBinding *(TrBinding_new(vm, frame));
+	binding.locals = Vector.New(0);
+	return &Repl{vm: vm, binding: binding};
+}
+
+// Evaluates code in the binding of the session. Returns TR_UNDEF on error, and incomplete if code
+// isn't a whole entry yet and more lines should be read.
+func (repl *Repl) eval(code string) (result RubyObject, incomplete bool) {
+	vm := repl.vm;
+	b := repl.binding;
+	block := Block_compile_with_locals(vm, code, TR_REPL_FILENAME, repl.line, b.locals);
+	if !block { return TR_UNDEF, vm.incomplete_input; }
+	if vm.debug { block.dump(vm, 0); }
+
+	frame := vm.newFrame(b.frame.self, b.frame.class, nil);
+	frame.cbase = b.frame.cbase;
+	result = vm.run_frame(frame, block, b.frame.stack[0:b.locals.Len()]);
+	// locals assigned before an exception are kept too
+	b.frame = frame;
+	b.locals = block.locals.Copy();
+	return result, false;
+}
+
+// Prints what went wrong with the last entry, and gets the VM ready for the next one.
+func (repl *Repl) report() {
+	vm := repl.vm;
+	if vm.throw_reason != TR_THROW_EXCEPTION {
+		// break or return out of the entry, which rescue can't catch either
+		vm.throw_value = TrException_new(vm, vm.cLocalJumpError, tr_sprintf(vm, "unexpected break or return"));
+	}
+	TrException_report(vm, vm.throw_value);
+	vm.throw_reason = vm.throw_value = 0;
+}
+
+// Reads entries from stdin until its end, printing the inspected value of each.
+func (repl *Repl) run() {
+	vm := repl.vm;
+	in := bufio.NewReader(os.Stdin);
+	entry := "";
+	for {
+		if entry == "" { fmt.Fprint(vm.out, TR_REPL_PROMPT); } else { fmt.Fprint(vm.out, TR_REPL_MORE); }
+		line, err := in.ReadString('\n');
+		if line == "" && err != nil {
+			fmt.Fprintln(vm.out);
+			return;
+		}
+		if !strings.HasSuffix(line, "\n") { line += "\n"; }
+		entry += line;
+		if strings.TrimSpace(entry) == "" {
+			entry = "";
+			continue;
+		}
+
+		result, incomplete := repl.eval(entry);
+		if incomplete && err == nil { continue; }
+		repl.line += strings.Count(entry, "\n");
+		entry = "";
+		if result == TR_UNDEF {
+			repl.report();
+			continue;
+		}
+		inspect := Object_send(vm, result, 1, { TrSymbol_new(vm, "inspect") });
+		if inspect == TR_UNDEF {
+			repl.report();
+			continue;
+		}
+		fmt.Fprintf(vm.out, "=> %s\n", inspect.ptr);
+	}
+}
@@ -0,0 +1,67 @@
+package RubyVM
+
+import (
+	"bytes";
+	"testing";
+)
+
+func TestReplIncompleteEntries(t *testing.T) {
+	repl := newRepl(newRubyVM());
+	for _, code := range []string{"def answer\n", "if true\n", "[1,\n", "x = \"open\n", "begin\n  1\n"} {
+		if result, incomplete := repl.eval(code); result != TR_UNDEF || !incomplete {
+			t.Errorf("%q: expected an incomplete entry", code);
+		}
+	}
+	if result, incomplete := repl.eval("def answer\n  42\nend\n"); result == TR_UNDEF || incomplete {
+		t.Fatalf("a whole def should be evaluated");
+	}
+	if result, _ := repl.eval("answer\n"); result != TR_INT2FIX(42) {
+		t.Errorf("answer should be 42");
+	}
+}
+
+func TestReplSyntaxErrorIsComplete(t *testing.T) {
+	repl := newRepl(newRubyVM());
+	if result, incomplete := repl.eval("end\n"); result != TR_UNDEF || incomplete {
+		t.Errorf("a syntax error before the end of the entry shouldn't wait for more lines");
+	}
+}
+
+func TestReplLocalsPersist(t *testing.T) {
+	repl := newRepl(newRubyVM());
+	repl.eval("x = 40\n");
+	repl.eval("y = x + 1\n");
+	if result, _ := repl.eval("x + y\n"); result != TR_INT2FIX(81) {
+		t.Errorf("locals of earlier entries should be kept");
+	}
+}
+
+func TestReplLocalsPersistAfterException(t *testing.T) {
+	vm := newRubyVM();
+	repl := newRepl(vm);
+	if result, _ := repl.eval("z = 2\nraise \"oops\"\n"); result != TR_UNDEF {
+		t.Fatalf("raise should fail the entry");
+	}
+	vm.throw_reason = vm.throw_value = 0;
+	if result, _ := repl.eval("z\n"); result != TR_INT2FIX(2) {
+		t.Errorf("locals assigned before an exception should be kept");
+	}
+}
+
+func TestReplReportsLocalJumpError(t *testing.T) {
+	vm := newRubyVM();
+	out := new(bytes.Buffer);
+	vm.out = out;
+	repl := newRepl(vm);
+	// inside an ensure clause the return is thrown out of the entry
+	if result, _ := repl.eval("begin\n  return 1\nensure\nend\n"); result != TR_UNDEF {
+		t.Fatalf("return out of an entry should fail it");
+	}
+	repl.report();
+	if out.String() != "LocalJumpError: unexpected break or return\n" {
+		t.Errorf("unexpected report %q", out.String());
+	}
+	if vm.throw_reason != 0 {
+		t.Errorf("report should clear the throw");
+	}
+}
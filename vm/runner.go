@@ -0,0 +1,251 @@
+import (
+	"bytes";
+	"encoding/xml";
+	"fmt";
+	"os";
+	"path/filepath";
+	"runtime";
+	"strings";
+	"sync";
+	"time";
+	"tr";
+)
+
+const (
+	TR_TEST_DIR = "test";
+	TR_TEST_PENDING = "test/pending";		// tests known to fail, their failures don't fail the run
+	TR_TEST_EXPECT = "# => ";				// lines of a test starting with this are its expected output
+)
+
+// Outcome of running one test file.
+type TestResult struct {
+	File			string;
+	Pending			bool;
+	Expected		string;
+	Actual			string;
+	Time			time.Duration;
+}
+
+func (r *TestResult) Passed() bool {
+	return r.Expected == r.Actual;
+}
+
+// Returns the expected output of a test, the "# => " lines without their prefix.
+func test_expectation(code string) string {
+	lines := make([]string, 0, 16);
+	for _, line := range strings.Split(code, "\n") {
+		if strings.HasPrefix(line, TR_TEST_EXPECT) { lines = append(lines, line[len(TR_TEST_EXPECT):]); }
+	}
+	return strings.Join(lines, "\n");
+}
+
+// Returns the tests of dir whose name, without the .rb extension, matches the glob pattern.
+func test_files(dir, pattern string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.rb"));
+	if err != nil { return nil, err; }
+	matching := make([]string, 0, len(files));
+	for _, file := range files {
+		matched, err := filepath.Match(pattern, strings.TrimSuffix(filepath.Base(file), ".rb"));
+		if err != nil { return nil, err; }
+		if matched { matching = append(matching, file); }
+	}
+	return matching, nil;
+}
+
+// Runs a test file in a VM of its own, with what it prints and any uncaught exception it raises
+// captured the way the tinyrb command would print them. A crash of the VM fails the test only.
+func run_test(file string, pending bool) (result *TestResult) {
+	result = &TestResult{File: file, Pending: pending};
+	start := time.Now();
+	out := new(bytes.Buffer);
+	defer func() {
+		if err := recover(); err != nil { fmt.Fprintf(out, "tinyrb crashed: %v\n", err); }
+		result.Actual = strings.TrimSuffix(out.String(), "\n");
+		result.Time = time.Since(start);
+	}();
+
+	code, err := os.ReadFile(file);
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", err);
+		return result;
+	}
+	result.Expected = test_expectation(string(code));
+	vm := newRubyVM();
+	vm.out = out;
+	if vm.load(file) == TR_UNDEF && vm.throw_reason == TR_THROW_EXCEPTION { TrException_report(vm, vm.throw_value); }
+	return result;
+}
+
+// Runs the files with as many at once as there are CPUs, calling done as each one finishes.
+func run_tests(files []string, pending map[string]bool, done func(*TestResult)) []*TestResult {
+	results := make([]*TestResult, len(files));
+	queue := make(chan int);
+	var lock sync.Mutex;
+	var workers sync.WaitGroup;
+	for n := 0; n < runtime.NumCPU(); n++ {
+		workers.Add(1);
+		go func() {
+			defer workers.Done();
+			for i := range queue {
+				results[i] = run_test(files[i], pending[files[i]]);
+				lock.Lock();
+				done(results[i]);
+				lock.Unlock();
+			}
+		}();
+	}
+	for i := range files { queue <- i; }
+	close(queue);
+	workers.Wait();
+	return results;
+}
+
+// Returns a line diff of expected and actual: lines of both are prefixed by a space, the
+// missing ones by -, the unexpected ones by +.
+func test_diff(expected, actual string) string {
+	a, b := strings.Split(expected, "\n"), strings.Split(actual, "\n");
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a) + 1);
+	for i := range common { common[i] = make([]int, len(b) + 1); }
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i + 1][j + 1] + 1;
+			} else if common[i + 1][j] >= common[i][j + 1] {
+				common[i][j] = common[i + 1][j];
+			} else {
+				common[i][j] = common[i][j + 1];
+			}
+		}
+	}
+	diff := new(bytes.Buffer);
+	i, j := 0, 0;
+	for i < len(a) || j < len(b) {
+		switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				fmt.Fprintf(diff, "     %s\n", a[i]);
+				i++;
+				j++;
+			case j == len(b) || (i < len(a) && common[i + 1][j] >= common[i][j + 1]):
+				fmt.Fprintf(diff, "   - %s\n", a[i]);
+				i++;
+			default:
+				fmt.Fprintf(diff, "   + %s\n", b[j]);
+				j++;
+		}
+	}
+	return diff.String();
+}
+
+type JUnitSuite struct {
+	XMLName			xml.Name		`xml:"testsuite"`;
+	Name			string			`xml:"name,attr"`;
+	Tests			int				`xml:"tests,attr"`;
+	Failures		int				`xml:"failures,attr"`;
+	Skipped			int				`xml:"skipped,attr"`;
+	Time			string			`xml:"time,attr"`;
+	Cases			[]JUnitCase		`xml:"testcase"`;
+}
+
+type JUnitCase struct {
+	Name			string			`xml:"name,attr"`;
+	Classname		string			`xml:"classname,attr"`;
+	Time			string			`xml:"time,attr"`;
+	Failure			*JUnitMessage	`xml:"failure,omitempty"`;
+	Skipped			*JUnitMessage	`xml:"skipped,omitempty"`;
+}
+
+type JUnitMessage struct {
+	Message			string			`xml:"message,attr"`;
+	Text			string			`xml:",chardata"`;
+}
+
+// Writes the results as a JUnit report, failing pending tests are reported as skipped.
+func write_junit(filename string, results []*TestResult, elapsed time.Duration) error {
+	suite := JUnitSuite{Name: "tinyrb", Tests: len(results), Time: fmt.Sprintf("%.3f", elapsed.Seconds())};
+	for _, r := range results {
+		c := JUnitCase{Name: r.File, Classname: "tinyrb." + strings.TrimSuffix(filepath.Base(r.File), ".rb"), Time: fmt.Sprintf("%.3f", r.Time.Seconds())};
+		switch {
+			case r.Passed():
+			case r.Pending:
+				c.Skipped = &JUnitMessage{Message: "pending", Text: test_diff(r.Expected, r.Actual)};
+				suite.Skipped++;
+			default:
+				c.Failure = &JUnitMessage{Message: "output doesn't match the # => lines", Text: test_diff(r.Expected, r.Actual)};
+				suite.Failures++;
+		}
+		suite.Cases = append(suite.Cases, c);
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ");
+	if err != nil { return err; }
+	return os.WriteFile(filename, append([]byte(xml.Header), append(data, '\n')...), 0644);
+}
+
+// tinyrb test [--junit=file] [pattern]
+// Runs test/*.rb and test/pending/*.rb, the ones whose name matches pattern if given, from the
+// root of the source tree. Returns 1 if any test outside of test/pending fails.
+func test_main(args []string) int {
+	pattern, junit := "*", "";
+	for _, arg := range args {
+		switch {
+			case strings.HasPrefix(arg, "--junit="): junit = strings.TrimPrefix(arg, "--junit=");
+			case strings.HasPrefix(arg, "-"): return usage();
+			default: pattern = arg;
+		}
+	}
+	if _, err := os.Stat(TR_TEST_DIR); err != nil {
+		fmt.Printf("tinyrb: no %s directory, run from the root of the source tree\n", TR_TEST_DIR);
+		return 1;
+	}
+	var pending_files []string;
+	files, err := test_files(TR_TEST_DIR, pattern);
+	if err == nil {
+		pending_files, err = test_files(TR_TEST_PENDING, pattern);
+	}
+	if err != nil {
+		fmt.Printf("tinyrb: %s\n", err);
+		return 1;
+	}
+	pending := make(map[string]bool);
+	for _, file := range pending_files { pending[file] = true; }
+	files = append(files, pending_files...);
+
+	start := time.Now();
+	results := run_tests(files, pending, func(r *TestResult) {
+		switch {
+			case r.Passed(): fmt.Print(".");
+			case r.Pending: fmt.Print("P");
+			default: fmt.Print("F");
+		}
+	});
+	elapsed := time.Since(start);
+	fmt.Println();
+	fmt.Println();
+
+	failures, still_pending := 0, 0;
+	for _, r := range results {
+		switch {
+			case r.Passed() && r.Pending:
+				fmt.Printf("[%s] passes now, move it out of %s\n", r.File, TR_TEST_PENDING);
+				fmt.Println();
+			case r.Passed():
+			case r.Pending:
+				still_pending++;
+			default:
+				failures++;
+				fmt.Printf("[%s]\n", r.File);
+				fmt.Print(test_diff(r.Expected, r.Actual));
+				fmt.Println();
+		}
+	}
+	fmt.Printf("%d tests, %d failures, %d pending (%.2fs)\n", len(results), failures, still_pending, elapsed.Seconds());
+
+	if junit != "" {
+		if err := write_junit(junit, results, elapsed); err != nil {
+			fmt.Printf("tinyrb: %s\n", err);
+			return 1;
+		}
+	}
+	if failures > 0 { return 1; }
+	return 0;
+}
@@ -0,0 +1,67 @@
+package RubyVM
+
+import (
+	"encoding/xml";
+	"os";
+	"path/filepath";
+	"strings";
+	"testing";
+	"time";
+)
+
+func TestTestExpectation(t *testing.T) {
+	code := "puts 1\n# => 1\n# not expected\nputs \"\"\n# => \n#=> no space\n  # => indented\n# => # => nested\n";
+	if expected := test_expectation(code); expected != "1\n\n# => nested" {
+		t.Errorf("got %q", expected);
+	}
+	if expected := test_expectation("puts 1\n"); expected != "" {
+		t.Errorf("a test without # => lines expects nothing, got %q", expected);
+	}
+}
+
+func TestTestDiff(t *testing.T) {
+	tests := []struct {
+		expected, actual, diff string;
+	}{
+		{"a\nb", "a\nb", "     a\n     b\n"},
+		{"a\nb\nc", "a\nc", "     a\n   - b\n     c\n"},
+		{"a\nc", "a\nb\nc", "     a\n   + b\n     c\n"},
+		{"a\nb", "a\nx", "     a\n   - b\n   + x\n"},
+		{"", "oops", "   - \n   + oops\n"},
+	};
+	for _, test := range tests {
+		if diff := test_diff(test.expected, test.actual); diff != test.diff {
+			t.Errorf("test_diff(%q, %q) = %q, expected %q", test.expected, test.actual, diff, test.diff);
+		}
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	results := []*TestResult{
+		&TestResult{File: "test/pass.rb", Expected: "1", Actual: "1", Time: time.Millisecond},
+		&TestResult{File: "test/fail.rb", Expected: "1", Actual: "2"},
+		&TestResult{File: "test/pending/todo.rb", Pending: true, Expected: "1", Actual: ""},
+	};
+	filename := filepath.Join(t.TempDir(), "junit.xml");
+	if err := write_junit(filename, results, 2 * time.Second); err != nil { t.Fatal(err); }
+	data, err := os.ReadFile(filename);
+	if err != nil { t.Fatal(err); }
+	if !strings.HasPrefix(string(data), xml.Header) { t.Errorf("missing XML header"); }
+
+	var suite JUnitSuite;
+	if err := xml.Unmarshal(data, &suite); err != nil { t.Fatal(err); }
+	if suite.Name != "tinyrb" || suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 || suite.Time != "2.000" {
+		t.Errorf("wrong suite attributes: %+v", suite);
+	}
+	if len(suite.Cases) != 3 { t.Fatalf("expected 3 test cases, got %d", len(suite.Cases)); }
+	pass, fail, pending := suite.Cases[0], suite.Cases[1], suite.Cases[2];
+	if pass.Classname != "tinyrb.pass" || pass.Time != "0.001" || pass.Failure != nil || pass.Skipped != nil {
+		t.Errorf("wrong passing case: %+v", pass);
+	}
+	if fail.Failure == nil || fail.Failure.Text != "   - 1\n   + 2\n" {
+		t.Errorf("a failing case should have the diff as its failure: %+v", fail);
+	}
+	if pending.Skipped == nil || pending.Failure != nil || pending.Skipped.Message != "pending" {
+		t.Errorf("a failing pending case should be skipped: %+v", pending);
+	}
+}
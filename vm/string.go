@@ -31,7 +31,7 @@ func TrSymbol_new(vm *RubyVM, str *string) RubyObject {
 	return id;
 }
 
-func TrSymbol_to_s(vm *RubyVM, self *RubyObject) RubyObject {
+func TrSymbol_to_s(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
@@ -42,16 +42,16 @@ func TrSymbol_to_s(vm *RubyVM, self *RubyObject) RubyObject {
 
 func TrSymbol_init(vm *RubyVM) {
 	c := vm.classes[TR_T_Symbol] = Object_const_set(vm, vm.self, TrSymbol_new(vm, Symbol), newClass(vm, TrSymbol_new(vm, Symbol), vm.classes[TR_T_Object]));
-	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, (TrFunc *)TrSymbol_to_s, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrSymbol_to_s, TR_NIL, 0));
 }
 
 // string
 
-func TrString_to_s(vm *RubyVM, self *RubyObject) RubyObject {
+func TrString_to_s(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	return self;
 }
 
-func TrString_size(vm *RubyVM, self) RubyObject {
+func TrString_size(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
@@ -77,7 +77,8 @@ func TrString_new3(vm *RubyVM, len size_t) RubyObject {
 	return s;
 }
 
-func TrString_add(vm *RubyVM, self, other *RubyObject) RubyObject {
+func TrString_add(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
@@ -91,7 +92,8 @@ func TrString_add(vm *RubyVM, self, other *RubyObject) RubyObject {
 	return tr_sprintf(vm, "%s%s", self.ptr, other.ptr);
 }
 
-func TrString_push(vm *RubyVM, self, other *RubyObject) RubyObject {
+func TrString_push(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
@@ -110,7 +112,8 @@ func TrString_push(vm *RubyVM, self, other *RubyObject) RubyObject {
 	return self;
 }
 
-func TrString_replace(vm *RubyVM, self, other *RubyObject) RubyObject {
+func TrString_replace(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
@@ -125,7 +128,8 @@ func TrString_replace(vm *RubyVM, self, other *RubyObject) RubyObject {
 	return self;
 }
 
-func TrString_cmp(vm *RubyVM, self, other *RubyObject) RubyObject {
+func TrString_cmp(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	other := args[0];
 	if (!other.(String)) return TR_INT2FIX(-1);
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
@@ -135,9 +139,9 @@ func TrString_cmp(vm *RubyVM, self, other *RubyObject) RubyObject {
 	return TR_INT2FIX(strcmp(self.ptr, other.ptr));
 }
 
-func TrString_substring(vm *RubyVM, self, start, len *RubyObject) RubyObject {
-	int s = TR_FIX2INT(start);
-	int l = TR_FIX2INT(len);
+func TrString_substring(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
+	int s = TR_FIX2INT(args[0]);
+	int l = TR_FIX2INT(args[1]);
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
@@ -147,7 +151,7 @@ func TrString_substring(vm *RubyVM, self, start, len *RubyObject) RubyObject {
 	return TrString_new(vm, self.ptr + s, l);
 }
 
-func TrString_to_sym(vm *RubyVM, self *RubyObject) RubyObject {
+func TrString_to_sym(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject {
 	if !self.(String) && !self.(Symbol) {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + self));
@@ -156,6 +160,22 @@ func TrString_to_sym(vm *RubyVM, self *RubyObject) RubyObject {
 	return TrSymbol_new(vm, self.ptr);
 }
 
+// Joins the parts of an interpolated literal, the ones that aren't Strings are converted with to_s.
+func TrString_interpolate(vm *RubyVM, argc int, argv []RubyObject) RubyObject {
+	buf := make([]byte, 0, 64);
+	for n := 0; n < argc; n++ {
+		part := argv[n];
+		if TR_IMMEDIATE(part) || !part.(String) {
+			part = Object_send(vm, part, 1, { TrSymbol_new(vm, "to_s") });
+			if part == TR_UNDEF { return TR_UNDEF; }
+			// like MRI, fallback to the default to_s
+			if TR_IMMEDIATE(part) || !part.(String) { part = Object_inspect(vm, argv[n]); }
+		}
+		buf = append(buf, part.ptr[0:part.len]...);
+	}
+	return TrString_new(vm, buf, len(buf));
+}
+
 // Uses variadic ... parameter which replaces the mechanism used by stdarg.h
 func tr_sprintf(vm *RubyVM, fmt *string, args ...) RubyObject {
 	arg va_list;
@@ -172,12 +192,12 @@ func tr_sprintf(vm *RubyVM, fmt *string, args ...) RubyObject {
 
 func TrString_init(vm *RubyVM) {
 	c := vm.classes[TR_T_String] = Object_const_set(vm, vm.self, TrSymbol_new(vm, String), newClass(vm, TrSymbol_new(vm, String), vm.classes[TR_T_Object]));
-	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, (TrFunc *)TrString_to_s, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "to_sym"), newMethod(vm, (TrFunc *)TrString_to_sym, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "size"), newMethod(vm, (TrFunc *)TrString_size, TR_NIL, 0));
-	c.add_method(vm, TrSymbol_new(vm, "replace"), newMethod(vm, (TrFunc *)TrString_replace, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "substring"), newMethod(vm, (TrFunc *)ToString_substring, TR_NIL, 2));
-	c.add_method(vm, TrSymbol_new(vm, "+"), newMethod(vm, (TrFunc *)TrString_add, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "<<"), newMethod(vm, (TrFunc *)TrString_push, TR_NIL, 1));
-	c.add_method(vm, TrSymbol_new(vm, "<=>"), newMethod(vm, (TrFunc *)TrString_cmp, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "to_s"), newMethod(vm, TrString_to_s, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "to_sym"), newMethod(vm, TrString_to_sym, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "size"), newMethod(vm, TrString_size, TR_NIL, 0));
+	c.add_method(vm, TrSymbol_new(vm, "replace"), newMethod(vm, TrString_replace, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "substring"), newMethod(vm, TrString_substring, TR_NIL, 2));
+	c.add_method(vm, TrSymbol_new(vm, "+"), newMethod(vm, TrString_add, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "<<"), newMethod(vm, TrString_push, TR_NIL, 1));
+	c.add_method(vm, TrSymbol_new(vm, "<=>"), newMethod(vm, TrString_cmp, TR_NIL, 1));
 }
\ No newline at end of file
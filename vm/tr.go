@@ -16,6 +16,10 @@
 const (
 	TR_VERSION		"0.0";
 	TR_MAX_FRAMES	255;
+	TR_FIX_MAX		1 << 62 - 1;	// Fixnums lose a bit to the tag, anything out of this range is a Bignum
+	TR_FIX_MIN		-(1 << 62);
+	TR_POLY_CACHE	4;				// classes an inline cache holds before going megamorphic
+	TR_MAX_MISS		256;			// misses after which a megamorphic inline cache tries caching again
 )
 
 /* allocation macros */
@@ -30,6 +34,7 @@ const (
 #define TR_FALSE             OBJ(2)
 #define TR_TRUE              OBJ(4)
 #define TR_UNDEF             OBJ(6)
+#define TR_BOOL(X)           ((X) ? TR_TRUE : TR_FALSE)
 
 typedef unsigned long OBJ;
 typedef unsigned char u8;
@@ -41,8 +46,8 @@ typedef enum {
   /*  0 */ TR_T_Object, TR_T_Module, TR_T_Class, TR_T_Method, TR_T_Binding,
   /*  5 */ TR_T_Symbol, TR_T_String, TR_T_Fixnum, TR_T_Range, TR_T_Regexp,
   /* 10 */ TR_T_NilClass, TR_T_TrueClass, TR_T_FalseClass,
-  /* 12 */ TR_T_Array, TR_T_Hash,
-  /* 14 */ TR_T_Node,
+  /* 12 */ TR_T_Array, TR_T_Hash, TR_T_Proc,
+  /* 15 */ TR_T_Bignum, TR_T_Float, TR_T_Node,
   TR_T_MAX /* keep last */
 } TR_T;
 
@@ -62,6 +67,9 @@ const(
 	TR_T_FalseClass,
 	TR_T_Array;
 	TR_T_Hash;
+	TR_T_Proc;
+	TR_T_Bignum;
+	TR_T_Float;
 	TR_T_Node;
 	TR_T_MAX;			// keep last
 )
@@ -77,7 +85,23 @@ type TrCallSite struct {
 	method			*RubyObject;
 	message			*RubyObject;
 	method_missing	bool;
-	miss			size_t;
+	super			bool;				// call to the overridden method, passing the current block
+	serial			int;				// serial of class when the method was cached, it's stale once they differ
+}
+
+// Inline cache of a LOOKUP or SUPER instruction, allocated by the compiler. Holds the methods found
+// for the last classes of receivers seen, until there are too many and lookups go through
+// vm.method_cache.
+type TrInlineCache struct {
+	entries			[TR_POLY_CACHE]TrCallSite;
+	size			int;				// entries in use
+	megamorphic		bool;
+	miss			int;				// misses since the cache went megamorphic
+}
+
+type TrMethodKey struct {
+	class			*RubyObject;
+	message			*RubyObject;
 }
 
 type TrUpval struct {
@@ -85,13 +109,16 @@ type TrUpval struct {
 	closed			*RubyObject;		// value when closed
 }
 
-typedef OBJ (TrFunc)(vm *struct TrVM, receiver *RubyObject, ...);
+// Native methods get their arguments as a slice, however many there are, and the block passed to
+// the call, nil if none.
+type TrFunc func(vm *RubyVM, self RubyObject, args []RubyObject, block *Closure) RubyObject;
 
 type TrBinding struct {
 	type 			TR_T;
 	class			*RubyObject;
 	ivars			map[string] *RubyObject;
   	frame			*Frame;
+	locals			Vector;				// names of the locals in frame.stack, for code evaluated in it
 }
 
 type TrString struct {
@@ -124,23 +151,46 @@ type TrRegexp struct {
 	class			*RubyObject;
 	ivars			map[string] RubyObject;
   	re				*pcre;
+	source			string;				// pattern and options it was compiled from
+	options			int;
 }
 
 func usage() {
 	fmt.println("usage: tinyrb [options] [file]");
 	fmt.println("options:";
 	fmt.println("  -e   eval code");
+	fmt.println("  -i   interactive mode, after running file if any (default with no file on a terminal)");
+	fmt.println("  -I   add a directory to $LOAD_PATH");
+	fmt.println("  -c   compile file to bytecode, without running it");
+	fmt.println("  -o   bytecode file written by -c (default: file with a .trc extension)");
 	fmt.println("  -d   show debug info (multiple times for more)");
 	fmt.println("  -v   print version");
 	fmt.println("  -h   print this");
+	fmt.println("  --disasm[=json] file   print the bytecode of file instead of running it");
+	fmt.println("commands:");
+	fmt.println("  test [--junit=file] [pattern]   run the tests of test/, or the ones matching pattern");
+	fmt.println("  bench [-n iterations] [-o results.json] [pattern]   run the benchmarks of bench/");
+	fmt.println("  bench compare [-t percent] baseline.json current.json   flag benchmarks that got slower");
+	fmt.println("environment:");
+	fmt.println("  TINYRB_LIB   load the core library from this directory instead of the embedded copy");
 	return 1;
 }
 
 func main(argc int, argv *[]char) {
+	// commands, which make VMs of their own
+	if argc >= 2 && argv[1] == "test" { return test_main(argv[2:argc]); }
+	if argc >= 2 && argv[1] == "bench" { return bench_main(argv[2:argc]); }
+
 	int opt;
 	vm := newRubyVM();
+	include_dirs := 0;
+	compile, output := "", "";
+	interactive := false;
 
-	while((opt = getopt(argc, argv, "e:vdh")) != -1) {
+	// long options, which getopt doesn't know, come first
+	if argc == 3 && strings.HasPrefix(argv[1], "--disasm") { return disasm_main(vm, argv[1], argv[2]); }
+
+	while((opt = getopt(argc, argv, "e:I:c:o:ivdh")) != -1) {
 		switch(opt) {
 			case 'e':
 				if vm.eval(optarg, "<eval>") == TR_UNDEF && vm.throw_reason == TR_THROW_EXCEPTION {
@@ -148,8 +198,23 @@ func main(argc int, argv *[]char) {
 					abort();
 				}
 				return 0;
+			case 'I':
+				// directories given with -I are searched before the core lib, in the order given
+				load_path := Array *(vm.globals[TrSymbol_new(vm, "$LOAD_PATH")]);
+				load_path.values.Insert(include_dirs, TrString_new2(vm, absolute_path(optarg)));
+				include_dirs++;
+				continue;
+			case 'c':
+				compile = optarg;
+				continue;
+			case 'o':
+				output = optarg;
+				continue;
+			case 'i':
+				interactive = true;
+				continue;
 			case 'v':
-				fmt.println("tinyrb %s", TR_VERSION);
+				fmt.Printf("tinyrb %s\n", TR_VERSION);
 				return 1;
 			case 'd':
 				vm.debug++;
@@ -159,16 +224,60 @@ func main(argc int, argv *[]char) {
 		}
 	}
 
+	if compile != "" {
+		if vm.compile_file(compile, output) == TR_UNDEF && vm.throw_reason == TR_THROW_EXCEPTION {
+			TrException_default_handler(vm, vm.throw_value));
+			abort();
+		}
+		return 0;
+	}
+
 	// These lines allow us to tread argc and argv as though any switches were not there
 	argc -= optind;
 	argv += optind;
   
 	if (argc > 0) {
 		if vm.load(argv[argc - 1])) == TR_UNDEF && vm.throw_reason == TR_THROW_EXCEPTION {
-			TrException_default_handler(vm, vm.throw_value));
-			abort();
+			if !interactive {
+				TrException_default_handler(vm, vm.throw_value));
+				abort();
+			}
+			// the session still starts, with what the file defined before raising
+			TrException_report(vm, vm.throw_value);
+			vm.throw_reason = vm.throw_value = 0;
 		}
+		if !interactive { return 0; }
+	}
+	if interactive || stdin_is_tty() {
+		newRepl(vm).run();
 		return 0;
 	}
 	return usage();
+}
+
+// tinyrb --disasm[=text|json] file
+func disasm_main(vm *RubyVM, option, filename string) int {
+	format := strings.TrimPrefix(strings.TrimPrefix(option, "--disasm"), "=");
+	if format != "" && format != "text" && format != "json" { return usage(); }
+	code, err := read_file(filename);
+	if err != nil {
+		fmt.Printf("tinyrb: %s\n", err);
+		return 1;
+	}
+	block := Block_compile(vm, code, filename, 0);
+	if !block {
+		TrException_default_handler(vm, vm.throw_value);
+		return 1;
+	}
+	if format == "json" {
+		fmt.Println(Block_disassemble(vm, block).JSON());
+	} else {
+		fmt.Print(Block_disassemble(vm, block).Text());
+	}
+	return 0;
+}
+
+func stdin_is_tty() bool {
+	stats, err := os.Stdin.Stat();
+	return err == nil && stats.Mode() & os.ModeCharDevice != 0;
 }
\ No newline at end of file
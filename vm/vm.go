@@ -7,6 +7,11 @@ import (
 // #include <sys/stat.h>
 // #include <assert.h>
 	"bytes";
+	"io";
+	"lib";
+	"path";
+	"reflect";
+	"strings";
 	"tr";
 	"opcode";
 	"call";
@@ -20,12 +25,21 @@ type Frame struct {
 	closure					*Closure;
 	method					*Method;				// current called method
 	stack					*RubyObject;
-	upvals					*RubyObject;
+	upvals					Vector;					// open upvalues pointing into stack
 	self					*RubyObject;
 	class					*RubyObject;
+	cbase					*RubyObject;			// innermost lexically enclosing module, for constant lookup
 	filename				*RubyObject;
 	line					size_t;
+	column					int;
 	previous				*Frame;
+	home					*Frame;					// for a block, the frame of the method it's in
+}
+
+// Returns the frame of the method running in frame, the one a return leaves.
+func (frame *Frame) method_frame() *Frame {
+	if frame.home { return frame.home; }
+	return frame;
 }
 
 func (vm *RubyVM) newFrame(self, class, closure *RubyObject) Frame {
@@ -35,19 +49,35 @@ func (vm *RubyVM) newFrame(self, class, closure *RubyObject) Frame {
 type RubyVM struct {
 	symbols				*map[string] string;
 	globals				*map[string] *RubyObject;
-	consts				*map[string] *RubyObject;				// TODO this goes in modules
+	consts				*map[string] *RubyObject;				// constants of Object
 	classes				[TR_T_MAX]*RubyObject;					// core classes
 	top_frame			*Frame;							// top level frame
 	frame				*Frame;							// current frame
 	cf					int;							// current frame number
 	self				*RubyObject;							// root object
 	debug				int;
+	out					io.Writer;								// where puts and uncaught exceptions print
+	incomplete_input	bool;									// last compile error was a premature end of input
 	throw_reason		int;
 	throw_value			*RubyObject;
+	break_target		*Closure;						// closure a TR_THROW_BREAK was thrown from
+	return_target		*Frame;							// frame of the method a TR_THROW_RETURN returns from
+	method_cache		map[TrMethodKey] *TrCallSite;	// methods looked up by megamorphic call sites
+	fixnum_builtins		map[int] RubyObject;			// Fixnum methods of the arithmetic opcodes
+	fixnum_redefined	map[int] bool;
+	fixnum_serial		int;							// serial of Fixnum when fixnum_redefined was checked
+	go_types			map[reflect.Type] RubyObject;	// classes of the Go structs given to DefineStruct
+	go_errors			map[RubyObject] error;			// errors of Go funcs by the exception they were raised as
+
+	// counters, for tinyrb bench
+	instructions		uint64;							// instructions executed
+	cache_hits			uint64;							// calls whose method was in the inline cache of their site
+	cache_misses		uint64;
 
 	// exceptions
 	cException			*RubyObject;
 	cScriptError		*RubyObject;
+	cLoadError			*RubyObject;
 	cSyntaxError		*RubyObject;
 	cStandardError		*RubyObject;
 	cArgumentError		*RubyObject;
@@ -60,71 +90,182 @@ type RubyVM struct {
 	cSystemStackError	*RubyObject;
 	cNameError			*RubyObject;
 	cNoMethodError		*RubyObject;
+	cZeroDivisionError	*RubyObject;
+	cRangeError			*RubyObject;
+	cFloatDomainError	*RubyObject;
   
 	// cached objects
 	sADD				*RubyObject;
 	sSUB				*RubyObject;
 	sLT					*RubyObject;
+	sMUL				*RubyObject;
+	sDIV				*RubyObject;
+	sMOD				*RubyObject;
+	sEQ					*RubyObject;
+	sLE					*RubyObject;
+	sGT					*RubyObject;
+	sGE					*RubyObject;
 	sNEG				*RubyObject;
 	sNOT				*RubyObject;
+	sCOERCE				*RubyObject;
 }
 
+// Looks up the method msg of receiver and caches it in the inline cache of the CACHE
+// instruction preceding the LOOKUP at ip.
 func (vm *RubyVM) lookup(block *Block, receiver, msg *RubyObject, ip *MachineOP) RubyObject {
+	cache := TrInlineCache *(block.sites.At((*(ip - 1)).Get_Bx()));
+	if cache.megamorphic {
+		if cache.miss < TR_MAX_MISS { return vm.global_lookup(receiver, msg); }
+		// the receivers may have settled on a few classes since, try caching them again
+		cache.megamorphic = false;
+		cache.miss = 0;
+	}
+
 	method := Object_method(vm, receiver, msg);
 	if method == TR_UNDEF { return TR_UNDEF }
+	// an expired entry of the class is filled again in place
+	class := vm.class_of(receiver);
+	n := 0;
+	while (n < cache.size && cache.entries[n].class != class) { n++; }
+	if n == TR_POLY_CACHE {
+		cache.megamorphic = true;
+		cache.size = 0;
+		cache.miss = 0;
+		return vm.global_lookup(receiver, msg);
+	}
+	if n == cache.size { cache.size++; }
+	s := &cache.entries[n];
+	vm.cache_site(s, receiver, msg, method);
+	return s;
+}
 
-	boing = *(ip - 1);
-	// TODO do not prealloc TrCallSite here, every one is a memory leak and a new one is created on polymorphic calls.
-	if block.sites.n == block.sites.m {
-		if block.sites.m > 0 {
-			block.sites.m <<= 1;
-		} else {
-			block.sites.m = 2;
-		}
-		block.sites.a = (TrCallSite*)TR_REALLOC(block.sites.a, sizeof(TrCallSite) * block.sites.m);
+// Looks up a method in the global method cache, shared by megamorphic call sites.
+func (vm *RubyVM) global_lookup(receiver, msg *RubyObject) RubyObject {
+	if vm.method_cache == nil { vm.method_cache = make(map[TrMethodKey] *TrCallSite); }
+	class := vm.class_of(receiver);
+	key := TrMethodKey{class: class, message: msg};
+	if s, ok := vm.method_cache[key]; ok && s.serial == Class *(class).serial { return s; }
+	method := Object_method(vm, receiver, msg);
+	if method == TR_UNDEF { return TR_UNDEF }
+	s := new(TrCallSite);
+	vm.cache_site(s, receiver, msg, method);
+	vm.method_cache[key] = s;
+	return s;
+}
+
+func (vm *RubyVM) class_of(obj *RubyObject) RubyObject {
+	if TR_IMMEDIATE(obj) { return vm.classes[Object_type(vm, obj)]; }
+	return Object *(obj).class;
+}
+
+// Returns the message sent by an arithmetic opcode.
+func (vm *RubyVM) operator(op int) RubyObject {
+	switch op {
+		case TR_OP_ADD:	return vm.sADD;
+		case TR_OP_SUB:	return vm.sSUB;
+		case TR_OP_MUL:	return vm.sMUL;
+		case TR_OP_DIV:	return vm.sDIV;
+		case TR_OP_MOD:	return vm.sMOD;
+		case TR_OP_EQ:	return vm.sEQ;
+		case TR_OP_LT:	return vm.sLT;
+		case TR_OP_LE:	return vm.sLE;
+		case TR_OP_GT:	return vm.sGT;
+		case TR_OP_GE:	return vm.sGE;
 	}
-	s := block.sites.a + block.sites.n;
-	block.sites.n += 1;
-	if TR_IMMEDIATE(receiver) {
-		s.class = vm.classes[Object_type(vm, (receiver))];
-	} else {
-		s.class = Object *(receiver).class;
+	assert(0 && "BUG: not an arithmetic opcode");
+	return TR_NIL;
+}
+
+// Returns true if Fixnum's method for the arithmetic opcode op is still the builtin one, checking
+// again only when Fixnum or one of its ancestors changed.
+func (vm *RubyVM) fixnum_builtin(op int) bool {
+	fixnum := Class *(vm.classes[TR_T_Fixnum]);
+	if vm.fixnum_redefined == nil || vm.fixnum_serial != fixnum.serial {
+		vm.fixnum_redefined = make(map[int] bool);
+		for o, method := range vm.fixnum_builtins {
+			vm.fixnum_redefined[o] = fixnum.methods[vm.operator(o)] != method;
+		}
+		vm.fixnum_serial = fixnum.serial;
 	}
-	s.miss = 0;
+	return !vm.fixnum_redefined[op];
+}
+
+// Fills the call site s with the method found for msg on the class of receiver.
+func (vm *RubyVM) cache_site(s *TrCallSite, receiver, msg, method *RubyObject) {
+	s.class = vm.class_of(receiver);
+	s.serial = Class *(s.class).serial;
 	s.method = method;
 	s.message = msg;
+	s.method_missing = false;
 	if method == TR_NIL {
 		s.method = Object_method(vm, receiver, TrSymbol_new(vm, "method_missing"));
-		s.method_missing = 1;
+		s.method_missing = true;
 	}
-  
-	// Implement Monomorphic method cache by replacing the previous instruction (BOING) w/ CACHE that uses the CallSite to find the method instead of doing a full lookup.
-	if (*boing).OpCode == TR_OP_CACHE {
-		// Existing call site
-		// TODO maybe take existing call site hit miss into consideration to replace it with this one. For now, we just don't replace it, the first one is always the cached one.
+}
+
+// Returns the call site of a SUPER instruction in frame from its cache, looking the overridden
+// method up only for the classes of self the instruction hasn't seen yet.
+func (vm *RubyVM) super_lookup(cache *TrInlineCache, frame *Frame) RubyObject {
+	class := vm.class_of(frame.self);
+	n := 0;
+	while (n < cache.size && cache.entries[n].class != class) { n++; }
+	if n < cache.size && cache.entries[n].serial == Class *(class).serial { return &cache.entries[n]; }
+	// an expired entry of the class is filled again in place, super is rarely polymorphic and a
+	// full cache simply starts over
+	if n == TR_POLY_CACHE { n, cache.size = 0, 0; }
+	s := &cache.entries[n];
+	if vm.super_site(frame, s) == TR_UNDEF { return TR_UNDEF; }
+	s.serial = Class *(class).serial;
+	if n == cache.size { cache.size++; }
+	return s;
+}
+
+// Fills s with the method overridden by the one running in frame: the next method with the same
+// name after the class defining it in the ancestors of self, which include metaclasses and
+// included modules.
+func (vm *RubyVM) super_site(frame *Frame, s *TrCallSite) RubyObject {
+	method := frame.method;
+	if TR_IMMEDIATE(frame.self) {
+		class := vm.classes[Object_type(vm, frame.self)];
 	} else {
-		// New call site, we cache it fo shizzly!
-		(*boing).OpCode = TR_OP_CACHE;
-		(*boing).A = (*ip).A; 						// receiver register
-		(*boing).B = 1;								// jmp
-		(*boing).C = block.sites.Len() - 1;			// CallSite index
+		class := Object *(frame.self).class;
 	}
+	while (class && Class *(class).methods[method.name] != method) { class = Class *(class).super; }
+	super := TR_NIL;
+	if class && Class *(class).super { super = Class *(class).super.instance_method(vm, method.name); }
+	if super == TR_NIL {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cNoMethodError, tr_sprintf(vm, "super: no superclass method `%s'", method.name.ptr));
+		return TR_UNDEF;
+	}
+	s.class = vm.class_of(frame.self);
+	s.method = super;
+	s.message = method.name;
+	s.method_missing = false;
+	s.super = true;
 	return s;
 }
 
 func (vm *RubyVM) defclass(name *RubyObject, block *Block, module int, super *RubyObject) RubyObject {
-	mod := Object_const_get(vm, vm.frame.class, name);
-	if mod == TR_UNDEF { return TR_UNDEF }
+	cbase := vm.frame.cbase || vm.classes[TR_T_Object];
+	// only reopen a module of the current scope, class A inside module M defines M::A even if there's a top level A
+	mod := Class *(cbase).consts[name];
   
 	if !mod {
-		// new module/class
+		// new module/class, named after the scope it's defined in
+		if cbase != vm.classes[TR_T_Object] {
+			full_name := TrSymbol_new(vm, tr_sprintf(vm, "%s::%s", Class *(cbase).name.ptr, name.ptr).ptr);
+		} else {
+			full_name := name;
+		}
 		if module {
-			mod := vm.newModule(name);
+			mod := vm.newModule(full_name);
 		} else {
-			mod := newClass(vm, name, super ? super : vm.classes[TR_T_Object]);
+			mod := newClass(vm, full_name, super ? super : vm.classes[TR_T_Object]);
 		}
 		if mod == TR_UNDEF { return TR_UNDEF }
-		Object_const_set(vm, vm.frame.class, name, mod);
+		Class *(mod).parent = cbase;
+		Object_const_set(vm, cbase, name, mod);
 	}
 
 	// push a frame
@@ -132,10 +273,12 @@ func (vm *RubyVM) defclass(name *RubyObject, block *Block, module int, super *Ru
 	if vm.cf >= TR_MAX_FRAMES {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cSystemStackError, tr_sprintf(vm, "Stack overflow"));
+		vm.cf--;
 		return TR_UNDEF;
 	}
 
 	frame := newFrame(mod, mod, nil);
+	frame.cbase = mod;
 	if vm.cf == 0 { vm.top_frame = frame; }
 	vm.frame = frame;
 	vm.throw_reason = vm.throw_value = 0;
@@ -149,61 +292,63 @@ func (vm *RubyVM) defclass(name *RubyObject, block *Block, module int, super *Ru
 	return mod;
 }
 
-func (vm *RubyVM) interpret_method(self *RubyObject, args []RubyObject) RubyObject {
-	assert(vm.frame.method);
+// Natives of the methods defined in Ruby, running the block of the method. Method.call checked
+// their arguments already.
+
+func interpret_method(vm *RubyVM, self RubyObject, args []RubyObject, closure *Closure) RubyObject {
 	block := Block *(vm.frame.method.data);
-	if args.Len() != block.argc {
-		vm.throw_reason = TR_THROW_EXCEPTION;
-		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "wrong number of arguments (%d for %lu)", args.Len(), block.argc));
-		return TR_UNDEF;
-	}
-	return vm.interpret(vm, vm.frame, block, 0, args, 0);
+	return vm.interpret(vm.frame, block, 0, args, 0);
 }
 
-func (vm *RubyVM) interpret_method_with_defaults(self *RubyObject, args []RubyObject) RubyObject {
-	assert(vm.frame.method);
+func interpret_method_with_defaults(vm *RubyVM, self RubyObject, args []RubyObject, closure *Closure) RubyObject {
 	block := Block *(vm.frame.method.data);
-	req_argc := block.argc - block.defaults.Len();
-	if args.Len() < req_argc {
-		vm.throw_reason = TR_THROW_EXCEPTION;
-		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "wrong number of arguments (%d for %d)", args.Len(), req_argc));
-		return TR_UNDEF;
-	}
-	if args.Len() > block.argc {
-		vm.throw_reason = TR_THROW_EXCEPTION;
-		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "wrong number of arguments (%d for %lu)", args.Len(), b.argc));
-		return TR_UNDEF;
-	}
 	// index in defaults table or -1 for none
-	if (i := args.Len() - req_argc - 1) < 0 {
+	if i := len(args) - (block.argc - block.defaults.Len()) - 1; i < 0 {
 		return vm.interpret(vm.frame, block, 0, args, 0);
 	} else {
 		return vm.interpret(vm.frame, block, block.defaults.At(i), args, 0);
 	}
 }
 
-func (vm *RubyVM) interpret_method_with_splat(self *RubyObject, args []RubyObject) RubyObject {
-	assert(vm.frame.method);
+func interpret_method_with_splat(vm *RubyVM, self RubyObject, args []RubyObject, closure *Closure) RubyObject {
 	block := Block *(vm.frame.method.data);
-	// TODO support defaults
-	assert(block.defaults.Len() == 0 && "defaults with splat not supported for now");
-	if args.Len() < b.argc - 1 {
-		vm.throw_reason = TR_THROW_EXCEPTION;
-		vm.throw_value = TrException_new(vm, vm.cArgumentError, tr_sprintf(vm, "wrong number of arguments (%d for %lu)", args.Len(), block.argc -1));
-		return TR_UNDEF;
+	// the args past the required and default ones go in an Array, there can be any number of them
+	positional := block.argc - 1;
+	n := len(args);
+	if n > positional { n = positional; }
+	locals := make([]RubyObject, block.argc);
+	copy(locals, args[0:n]);
+	if len(args) > positional {
+		locals[positional] = vm.newArray3(len(args) - positional, args[positional:]);
+	} else {
+		locals[positional] = vm.newArray();
+	}
+	// index in defaults table or -1 for none, the defaults not passed are evaluated
+	if i := n - (positional - block.defaults.Len()) - 1; i < 0 {
+		return vm.interpret(vm.frame, block, 0, locals, 0);
+	} else {
+		return vm.interpret(vm.frame, block, block.defaults.At(i), locals, 0);
 	}
-	argv[block.argc - 1] = vm.newArray3(args.Len() - block.argc + 1, &argv[block.argc - 1]);
-	return vm.interpret(vm.frame, block, 0, args[0:block.argc - 1], 0);
 }
 
 func (vm *RubyVM) defmethod(frame *Frame, name *RubyObject, block *Block, meta bool, receiver *RubyObject) RubyObject {
+	// arity like Method#arity: the number of args, or -1 - the required ones if there can be more
 	switch {
-		case block.arg_splat:			interpreter := TrFunc *(TrVM_interpret_method_with_splat);
-		case block.defaults.Len() > 0:	interpreter := TrFunc *(TrVM_interpret_method_with_defaults);
-		default:						interpreter := TrFunc *(TrVM_interpret_method);
+		case block.arg_splat:
+			interpreter := TrFunc(interpret_method_with_splat);
+			arity := -1 - (block.argc - 1 - block.defaults.Len());
+		case block.defaults.Len() > 0:
+			interpreter := TrFunc(interpret_method_with_defaults);
+			arity := -1 - (block.argc - block.defaults.Len());
+		default:
+			interpreter := TrFunc(interpret_method);
+			arity := block.argc;
 	}
-	method := newMethod(vm, interpreter, RubyObject(block), -1);
+	method := newMethod(vm, interpreter, RubyObject(block), arity);
 	if method == TR_UNDEF { return TR_UNDEF }
+	// defaults bound the number of args too
+	method.min_args, method.max_args = block.arg_range();
+	method.cbase = frame.cbase;
 	if meta {
 		Object_add_singleton_method(vm, receiver, name, method);
 	} else {
@@ -219,20 +364,42 @@ func (vm *RubyVM) yield(frame *Frame, args []RubyObject) RubyObject {
 		vm.throw_value = TrException_new(vm, vm.cLocalJumpError, tr_sprintf(vm, "no block given"));
 		return TR_UNDEF;
 	}
+	return vm.call_closure(closure, args);
+}
 
+func (vm *RubyVM) call_closure(closure *Closure, args []RubyObject) RubyObject {
 	// push a frame
 	vm.cf++;
 	if vm.cf >= TR_MAX_FRAMES {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cSystemStackError, tr_sprintf(vm, "Stack overflow"));
+		vm.cf--;
 		return TR_UNDEF;
 	}
 
 	closed_frame := newFrame(closure.self, closure.class, closure.parent);
+	closed_frame.method = closure.method;
+	closed_frame.cbase = closure.cbase;
+	if closure.frame { closed_frame.home = closure.frame.method_frame(); }
 	if vm.cf == 0 { vm.top_frame = closed_frame; }
 	vm.frame = closed_frame;
 	vm.throw_reason = vm.throw_value = 0;
 
+	// |a, *r| gets the args the others leave in an Array
+	if block := closure.block; block.arg_splat {
+		required := block.argc - 1;
+		locals := make([]RubyObject, block.argc);
+		for n := 0; n < required; n++ {
+			if n < len(args) { locals[n] = args[n]; } else { locals[n] = TR_NIL; }
+		}
+		if len(args) > required {
+			locals[required] = vm.newArray3(len(args) - required, args[required:]);
+		} else {
+			locals[required] = vm.newArray();
+		}
+		args = locals;
+	}
+
 	// execute BODY inside the frame
 	result := vm.interpret(vm.frame, closure.block, 0, args, closure);
 
@@ -252,18 +419,31 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 	i := *ip;
 	k := block.k.a;
 	Block **blocks = block.blocks.a;
-	frame.line = block.line;
+	frame.line, frame.column = block.position_at(start);
 	frame.filename = block.filename;
-	TrUpval *upvals = closure ? closure.upvals : 0;
+	TrUpval **upvals = closure ? closure.upvals : 0;
 	TrCallSite *call = 0;
 
+	// closures created in this frame keep the values they captured once it's gone
+	defer frame.close_upvals();
+
 	// transfer locals
 	if args.Len() > 0 { 
 		assert(args.Len() <= block.locals.Len() && "can't fit args in locals");
 		bytes.Add(stack, args);
 	}
+	// def m(&blk), the passed block is wrapped in a Proc
+	if block.arg_block {
+		if frame.closure {
+			stack[block.argc] = newProc(vm, frame.closure, false);
+		} else {
+			stack[block.argc] = TR_NIL;
+		}
+	}
   
 	for {
+		stop := false;		// a return throw stops at this frame
+		vm.instructions++;
 		switch i.OpCode {
 			// no-op
 			case TR_OP_BOING:
@@ -293,8 +473,17 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 			case TR_OP_NEWHASH:
 				stack[i.A] = TrHash_new2(vm, i.B, &stack[i.A + 1])
 
+			case TR_OP_UNPACK:
+				if TrArray_unpack(vm, stack[i.A], i.B, i.C, &stack[i.A + 1]) == TR_UNDEF { goto throw; }
+
 			case TR_OP_NEWRANGE:
 				stack[i.A] = TrRange_new(vm, stack[i.A], stack[i.B], i.C)
+
+			case TR_OP_DSTR:
+				if RubyObject(stack[i.A] = TrString_interpolate(vm, i.B, &stack[i.A])) == TR_UNDEF { goto throw; }
+				if i.C {
+					if RubyObject(stack[i.A] = TrRegexp_compile(vm, vm.classes[TR_T_Regexp], { stack[i.A] }, nil)) == TR_UNDEF { goto throw; }
+				}
     
 			// return
 			case TR_OP_RETURN:
@@ -303,10 +492,32 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 			case TR_OP_THROW:
 				vm.throw_reason = i.A;
 				vm.throw_value = stack[i.B]
-				return TR_UNDEF;
+				if i.A == TR_THROW_BREAK { vm.break_target = closure; }
+				if i.A == TR_THROW_RETURN { vm.return_target = frame.method_frame(); }
+				stop = !closure;
+				goto throw;
+
+			case TR_OP_RETHROW:
+				vm.throw_value = stack[i.A];
+				vm.throw_reason = TR_FIX2INT(stack[i.A + 1]);
+				stop = stack[i.A + 2] == TR_TRUE;
+				goto throw;
+
+			case TR_OP_RESCUE:
+				stack[i.A + 1] = TR_FALSE;
+				if i.B == 0 {
+					stack[i.A + 1] = Object_kind_of(vm, stack[i.A], vm.cStandardError);
+				}
+				for n := 0; n < i.B; n++ {
+					if Object_kind_of(vm, stack[i.A], stack[i.A + 2 + n]) == TR_TRUE {
+						stack[i.A + 1] = TR_TRUE;
+						break;
+					}
+				}
 
 			case TR_OP_YIELD:
-				if RubyObject(stack[i.A] = vm.yield(frame, i.B, &stack[i.A + 1])) == TR_UNDEF { return TR_UNDEF; }
+				frame.line, frame.column = block.position_at(ip - block.code.a);
+				if RubyObject(stack[i.A] = vm.yield(frame, i.B, &stack[i.A + 1])) == TR_UNDEF { goto throw; }
     
     		// variable and consts
     		case TR_OP_SETUPVAL:
@@ -330,10 +541,17 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 				stack[i.A] := frame.class.ivars[k[i.Get_Bx]] || TR_NIL;
 
     		case TR_OP_SETCONST:
-				Object_const_set(vm, frame.self, k[i.Get_Bx()], stack[i.A])
+				Object_const_set(vm, frame.cbase, k[i.Get_Bx()], stack[i.A])
 
     		case TR_OP_GETCONST:
-				stack[i.A] = Object_const_get(vm, frame.self, k[i.Get_Bx()])
+				frame.line, frame.column = block.position_at(ip - block.code.a);
+				if RubyObject(stack[i.A] = Object_const_get(vm, frame.cbase, k[i.Get_Bx()])) == TR_UNDEF { goto throw; }
+
+    		case TR_OP_GETSCOPE:
+				frame.line, frame.column = block.position_at(ip - block.code.a);
+				// nil stands for the top level in ::A
+				if stack[i.A] == TR_NIL { stack[i.A] = vm.classes[TR_T_Object]; }
+				if RubyObject(stack[i.A] = Module *(stack[i.A]).const_get(vm, k[i.Get_Bx()])) == TR_UNDEF { goto throw; }
 
     		case TR_OP_SETGLOBAL:
 				vm.globals[k[i.Get_Bx()]] = stack[i.A];
@@ -343,29 +561,56 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 
     		// method calling
     		case TR_OP_LOOKUP:
-				if RubyObject(call = TrCallSite *(vm.lookup(block, stack[i.A], k[i.Get_Bx()], ip))) == TR_UNDEF { return TR_UNDEF; }
+				if RubyObject(call = TrCallSite *(vm.lookup(block, stack[i.A], k[i.Get_Bx()], ip))) == TR_UNDEF { goto throw; }
+
+    		case TR_OP_SUPER:
+				if !frame.method {
+					vm.throw_reason = TR_THROW_EXCEPTION;
+					vm.throw_value = TrException_new(vm, vm.cRuntimeError, tr_sprintf(vm, "super called outside of method"));
+					goto throw;
+				}
+				if RubyObject(call = TrCallSite *(vm.super_lookup(TrInlineCache *(block.sites.At(i.Get_Bx())), frame))) == TR_UNDEF { goto throw; }
 
     		case TR_OP_CACHE:
-				// TODO how to expire cache?
-				assert(&block.sites.a[i.C] && "Method cached but no CallSite found");
-				if TR_IMMEDIATE(stack[i.A]) {
-					class := vm.classes[Object_type(vm, stack[i.A])];
-				} else {
-					class := Object *(stack[i.A]).class;
+				cache := TrInlineCache *(block.sites.At(i.Get_Bx()));
+				hit := false;
+				class := vm.class_of(stack[i.A]);
+				for n := 0; n < cache.size && !hit; n++ {
+					// an entry is stale once a method of the class or an ancestor changed
+					if cache.entries[n].class == class && cache.entries[n].serial == Class *(class).serial {
+						call = &cache.entries[n];
+						hit = true;
+					}
 				}
-				if block.sites.a[i.C].class == class {
-					call = &block.sites.a[i.C]
-					ip += i.B;
+				if hit {
+					// skip the LOOKUP
+					ip++;
+					vm.cache_hits++;
 				} else {
-					// TODO invalidate CallSite if too much miss.
-        			block.sites.a[i.C].miss++
+					cache.miss++;
+					vm.cache_misses++;
 				}
 
 			case TR_OP_CALL:
+				frame.line, frame.column = block.position_at(ip - block.code.a);
 				Closure *cl = 0;
 				ci := i;
 
-				if i.C > 0 {
+				if i.C == TR_CALL_BLOCK_PASS {
+					// m(&blk), the block is the Proc following the args
+					blk := stack[i.A + 2 + (i.B >> 1)];
+					if blk != TR_NIL {
+						if !blk.(Proc) {
+							if RubyObject(blk = Object_send(vm, blk, 1, { TrSymbol_new(vm, "to_proc") })) == TR_UNDEF { goto throw; }
+						}
+						if !blk.(Proc) {
+							vm.throw_reason = TR_THROW_EXCEPTION;
+							vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "wrong argument type (expected Proc)"));
+							goto throw;
+						}
+						cl = Proc *(blk).closure;
+					}
+				} else if i.C > 0 {
 					// Get upvalues using the pseudo-instructions following the CALL instruction.
 					//	Eg.: there's one upval to a local (x) to be passed:
 					//	call    0  0  0
@@ -373,17 +618,22 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 					//	return  0
 
 					cl = newClosure(vm, blocks[i.C - 1], frame.self, frame.class, frame.closure);
+					cl.method = frame.method;
+					cl.cbase = frame.cbase;
+					cl.frame = frame;
 					size_t n, nupval = cl.block.upvals.Len();
 					for (n = 0; n < nupval; ++n) {
 						(i = *++ip)
 						if i.OpCode == TR_OP_MOVE {
-							cl.upvals[n].value = &stack[i.B];
+							cl.upvals[n] = frame.upval(i.B);
 						} else {
 							assert(i.OpCode == TR_OP_GETUPVAL);
-							cl.upvals[n].value = upvals[i.B].value;
+							cl.upvals[n] = upvals[i.B];
 						}
 					}
 				}
+				// super without a block passes the current one
+				if ci.C == 0 && call.super { cl = frame.closure; }
 				argc := ci.B >> 1;
 				argv := &stack[ci.A + 2];
 				if call.method_missing {
@@ -406,16 +656,30 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 				if ret == TR_UNDEF {
 					switch vm.throw_reason {
 						case TR_THROW_EXCEPTION:
-							// TODO run rescue and stop propagation if rescued
-							// TODO run ensure block
-            				return TR_UNDEF;
+							goto throw;
 
 						case TR_THROW_RETURN:
-							// TODO run ensure block
-            				if frame.closure { return TR_UNDEF; }
-            				return vm.throw_value;
+							// return in a block leaves the method the block is in, if it's still running
+							if !vm.frame_active(vm.return_target) {
+								vm.throw_reason = TR_THROW_EXCEPTION;
+								vm.throw_value = TrException_new(vm, vm.cLocalJumpError, tr_sprintf(vm, "unexpected return"));
+							}
+							stop = frame == vm.return_target;
+							goto throw;
 
 						case TR_THROW_BREAK:
+							// break in the block passed to this call, the call returns the value of the break
+							if cl && vm.break_target == cl {
+								ret = vm.throw_value;
+								vm.throw_reason = vm.throw_value = 0;
+								break;
+							}
+							// the call the block was passed to is over
+							if vm.break_target.frame == frame || !vm.frame_active(vm.break_target.frame) {
+								vm.throw_reason = TR_THROW_EXCEPTION;
+								vm.throw_value = TrException_new(vm, vm.cLocalJumpError, tr_sprintf(vm, "break from proc-closure"));
+							}
+							goto throw;
 
           				default:
 							assert(0 && "BUG: invalid throw_reason");
@@ -425,18 +689,20 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
     
 			// definition
 			case TR_OP_DEF:
-				if RubyObject(vm.defmethod(frame, k[i.Get_Bx()], blocks[i.A], 0, 0)) == TR_UNDEF { return TR_UNDEF; }
+				if RubyObject(vm.defmethod(frame, k[i.Get_Bx()], blocks[i.A], 0, 0)) == TR_UNDEF { goto throw; }
 
 			case TR_OP_METADEF:
-				if RubyObject(vm.defmethod(frame, k[i.Get_Bx()], blocks[i.A], 1, stack[(*(ip + 1)).A])) == TR_UNDEF { return TR_UNDEF; }
+				if RubyObject(vm.defmethod(frame, k[i.Get_Bx()], blocks[i.A], 1, stack[(*(ip + 1)).A])) == TR_UNDEF { goto throw; }
 				ip++
 
 			case TR_OP_CLASS:
-				if RubyObject(vm.defclass(k[i.Get_Bx()], blocks[i.A], 0, stack[(*(ip + 1)).A])) == TR_UNDEF { return TR_UNDEF; }
+				frame.line, frame.column = block.position_at(ip - block.code.a);
+				if RubyObject(vm.defclass(k[i.Get_Bx()], blocks[i.A], 0, stack[(*(ip + 1)).A])) == TR_UNDEF { goto throw; }
 				ip++
 
 			case TR_OP_MODULE:
-				if RubyObject(vm.defclass(k[i.Get_Bx()], blocks[i.A], 1, 0)) == TR_UNDEF { return TR_UNDEF; }
+				frame.line, frame.column = block.position_at(ip - block.code.a);
+				if RubyObject(vm.defclass(k[i.Get_Bx()], blocks[i.A], 1, 0)) == TR_UNDEF { goto throw; }
     
 			// jumps
 			case TR_OP_JMP:
@@ -448,9 +714,8 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 			case TR_OP_JMPUNLESS:
  				if stack[i.A] == TR_NIL || stack[i.A] == TR_FALSE { ip += i.Get_sBx(); }
 
-    		// arithmetic optimizations
-    		// TODO cache lookup and force send if method was redefined
-			case TR_OP_ADD:
+    		// arithmetic optimizations, done here when both operands are Fixnums and Fixnum's method wasn't redefined
+			case TR_OP_ADD, TR_OP_SUB, TR_OP_MUL, TR_OP_DIV, TR_OP_MOD, TR_OP_EQ, TR_OP_LT, TR_OP_LE, TR_OP_GT, TR_OP_GE:
 				if i.B & (1 << (SIZE_B - 1) {
 					rb := k[i.B & ~0x100]
 				} else {
@@ -463,53 +728,22 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 					rc := stack[i.C]
 				}
 
-				if TR_IS_FIX(rb) {
-					stack[i.A] = TR_INT2FIX(TR_FIX2INT(rb) + TR_FIX2INT(rc))
-				} else {
-					stack[i.A] = Object_send(vm, rb, 2, { vm.sADD, rc });
-				}
-
-			case TR_OP_SUB:
-				if i.B & (1 << (SIZE_B - 1) {
-					rb := k[i.B & ~0x100]
-				} else {
-					rb := stack[i.B]
-				}
-
-				if i.C & (1 << (SIZE_B - 1) {
-					rc := k[i.C & ~0x100]
-				} else {
-					rc := stack[i.C]
-				}
-
-				if TR_IS_FIX(rb) {
-					stack[i.A] = TR_INT2FIX(TR_FIX2INT(rb) - TR_FIX2INT(rc))
-				} else {
-					stack[i.A] = Object_send(vm, rb, 2, { vm.sSUB, rc });
-				}
-
-			case TR_OP_LT:
-				if i.B & (1 << (SIZE_B - 1) {
-					rb := k[i.B & ~0x100]
-				} else {
-					rb := stack[i.B]
-				}
-
-				if i.C & (1 << (SIZE_B - 1) {
-					rc := k[i.C & ~0x100]
-				} else {
-					rc := stack[i.C]
-				}
-
-				if TR_IS_FIX(rb) {
-					if TR_FIX2INT(rb) < TR_FIX2INT(rc) {
-						stack[i.A] = TR_TRUE;
-					} else {
-						stack[i.A] = TR_FALSE;
+				frame.line, frame.column = block.position_at(ip - block.code.a);
+				if TR_IS_FIX(rb) && TR_IS_FIX(rc) && vm.fixnum_builtin(i.OpCode) {
+					switch i.OpCode {
+						case TR_OP_ADD:	stack[i.A] = TrInteger_new(vm, TR_FIX2INT(rb) + TR_FIX2INT(rc));
+						case TR_OP_SUB:	stack[i.A] = TrInteger_new(vm, TR_FIX2INT(rb) - TR_FIX2INT(rc));
+						case TR_OP_EQ:	stack[i.A] = TR_BOOL(rb == rc);
+						case TR_OP_LT:	stack[i.A] = TR_BOOL(TR_FIX2INT(rb) < TR_FIX2INT(rc));
+						case TR_OP_LE:	stack[i.A] = TR_BOOL(TR_FIX2INT(rb) <= TR_FIX2INT(rc));
+						case TR_OP_GT:	stack[i.A] = TR_BOOL(TR_FIX2INT(rb) > TR_FIX2INT(rc));
+						case TR_OP_GE:	stack[i.A] = TR_BOOL(TR_FIX2INT(rb) >= TR_FIX2INT(rc));
+						default:
+							// overflow and rounding of mul, div and mod are left to Fixnum, without a frame
+							if RubyObject(stack[i.A] = Method *(vm.fixnum_builtins[i.OpCode]).func(vm, rb, { rc }, nil)) == TR_UNDEF { goto throw; }
 					}
-
 				} else {
-					stack[i.A] = Object_send(vm, rb, 2, { vm.sLT, rc } );
+					if RubyObject(stack[i.A] = Object_send(vm, rb, 2, { vm.operator(i.OpCode), rc })) == TR_UNDEF { goto throw; }
 				}
 
 			case TR_OP_NEG:
@@ -519,14 +753,15 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 					rb := stack[i.B]
 				}
 				if TR_IS_FIX(rb) {
-					stack[i.A] = TR_INT2FIX(-TR_FIX2INT(rb))
+					stack[i.A] = TrInteger_new(vm, -TR_FIX2INT(rb))
 				} else {
 					if i.C & (1 << (SIZE_B - 1) {
 						rc := k[i.C & ~0x100]
 					} else {
 						rc := stack[i.C]
 					}
-					stack[i.A] = Object_send(vm, rb, 2, { vm.sNEG, rc });
+					frame.line, frame.column = block.position_at(ip - block.code.a);
+					if RubyObject(stack[i.A] = Object_send(vm, rb, 2, { vm.sNEG, rc })) == TR_UNDEF { goto throw; }
 				}
 
 			case TR_OP_NOT:
@@ -549,83 +784,231 @@ func (vm *RubyVM) TrVM_interpret(frame *Frame, block *Block, start, args []RubyO
 				os.Exit(1)
 		}
 		i = *++ip;
-		break;
+		continue;
+
+	throw:
+		// Something was thrown, resume in a rescue or ensure handler or leave the frame.
+		if ip = vm.unwind(frame, block, ip, stop); ip != nil {
+			i = *ip;
+			continue;
+		}
+		if vm.throw_reason == TR_THROW_RETURN && stop { return vm.throw_value; }
+		return TR_UNDEF;
+	}
+}
+
+// Returns true if frame is the current frame or one of its callers.
+func (vm *RubyVM) frame_active(frame *Frame) bool {
+	for f := vm.frame; f; f = f.previous {
+		if f == frame { return true; }
 	}
+	return false;
+}
+
+// Looks for a handler of the current throw protecting the instruction at ip. If one is found,
+// the throw is caught: its value (and for ensure handlers its reason and whether a return stops
+// at this frame) is stored in the handler registers and the handler's first instruction is returned.
+func (vm *RubyVM) unwind(frame *Frame, block *Block, ip *MachineOP, stop bool) *MachineOP {
+	pc := ip - block.code.a;
+	for h := range block.handlers.Iter() {
+		if pc < h.start || pc >= h.end { continue; }
+		if !h.ensure && vm.throw_reason != TR_THROW_EXCEPTION { continue; }
+		frame.stack[h.reg] = vm.throw_value;
+		if h.ensure {
+			frame.stack[h.reg + 1] = TR_INT2FIX(vm.throw_reason);
+			if stop {
+				frame.stack[h.reg + 2] = TR_TRUE;
+			} else {
+				frame.stack[h.reg + 2] = TR_FALSE;
+			}
+		} else {
+			vm.globals[TrSymbol_new(vm, "$!")] = vm.throw_value;
+			vm.globals[TrSymbol_new(vm, "$@")] = TrException_backtrace(vm, vm.throw_value, nil, nil);
+		}
+		vm.frame = frame;
+		vm.throw_reason = vm.throw_value = 0;
+		return block.code.a + h.handler;
+	}
+	return nil;
 }
 
 /* returns the backtrace of the current call frames */
 func (vm *RubyVM) backtrace() RubyObject {
 	backtrace := vm.newArray();
-	if vm.frame {
-		// skip a frame since it's the one doing the raising
-		frame := vm.frame.previous;
-		while (frame) {
-			if frame.filename {
-				method_name := Method *(f.method).name;
-				if !method_name.(String) && !method_name.(Symbol) {
-					vm.throw_reason = TR_THROW_EXCEPTION;
-					vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + method_name));
-					return TR_UNDEF;
-				}
-				filename := method_name.ptr;
-			} else {
-				filename := "?"
-			}
+	frame := vm.frame;
+	while (frame) {
+		// native frames, like the one doing the raising, have no filename and are skipped
+		if frame.filename {
 			if frame.method {
-				method_name := Method *(f.method).name;
-				if !method_name.(String) && !method_name.(Symbol) {
-					vm.throw_reason = TR_THROW_EXCEPTION;
-					vm.throw_value = TrException_new(vm, vm.cTypeError, TrString_new2(vm, "Expected " + method_name));
-					return TR_UNDEF;
-				}
-				context := tr_sprintf(vm, "\tfrom %s:%lu:in `%s'", filename, f.line, method_name.ptr);
+				context := tr_sprintf(vm, "%s:%lu:in `%s'", frame.filename.ptr, frame.line, Method *(frame.method).name.ptr);
 			} else {
-				context := tr_sprintf(vm, "\tfrom %s:%lu", filename, f.line);
+				context := tr_sprintf(vm, "%s:%lu", frame.filename.ptr, frame.line);
 			}
 			backtrace.Push(context);
-			frame = frame.previous;
 		}
+		frame = frame.previous;
 	}
 	return backtrace;
 }
 
+// Returns the position in the innermost Ruby frame as file:line:column, or nil.
+func (vm *RubyVM) location() RubyObject {
+	for frame := vm.frame; frame; frame = frame.previous {
+		if frame.filename { return tr_sprintf(vm, "%s:%lu:%d", frame.filename.ptr, frame.line, frame.column); }
+	}
+	return TR_NIL;
+}
+
 func (vm *RubyVM) eval(code *string, filename *string) RubyObject {
 	if block := Block_compile(vm, code, filename, 0) {
 		if (vm.debug) { block.dump(vm, 0); }
-		if TR_IMMEDIATE(vm.self) {
-			class := vm.classes[Object_type(vm, (vm.self))];
-		} else {
-			class := Object *(vm.self).class;
-		}
-		return vm.run(block, vm.self, class, nil);
+		return vm.run_toplevel(block);
 	} else {
 		return TR_UNDEF;
 	}
 }
 
+// Runs block at the top level, where self is the main object.
+func (vm *RubyVM) run_toplevel(block *Block) RubyObject {
+	if TR_IMMEDIATE(vm.self) {
+		class := vm.classes[Object_type(vm, (vm.self))];
+	} else {
+		class := Object *(vm.self).class;
+	}
+	return vm.run(block, vm.self, class, nil);
+}
+
+// Runs the source or bytecode file filename. A source file is run from the .trc next to it if that
+// was compiled from the source as it is now.
 func (vm *RubyVM) load(filename *string) RubyObject {
-	stats = new(stat);
-	if stat(filename, &stats) != -1 {
-		if fp := fopen(filename, "rb") {
-			s := make([]byte, stats.st_size + 1);
-			if fread(s, 1, stats.st_size, fp) == stats.st_size { return vm.eval(s, filename); }
+	if strings.HasSuffix(filename, ".trc") { return vm.load_bytecode(filename); }
+	code, err := read_file(filename);
+	if err != nil {
+		vm.throw_reason = TR_THROW_EXCEPTION;
+		vm.throw_value = TrException_new(vm, vm.cSystemCallError, tr_sprintf(vm, "%s: %s", err, filename);
+		return TR_UNDEF;
+	}
+	if block := vm.fresh_bytecode(filename, code); block != nil { return vm.run_toplevel(block); }
+	return vm.eval(code, filename);
+}
+
+// Returns the filename of the innermost Ruby frame, skipping native ones like the caller's own.
+func (vm *RubyVM) current_filename() RubyObject {
+	for frame := vm.frame; frame; frame = frame.previous {
+		if frame.filename { return frame.filename; }
+	}
+	return TR_NIL;
+}
+
+// Files under TR_LIB_EMBEDDED are the ones of lib/ embedded in the binary.
+const TR_LIB_EMBEDDED = "<lib>";
+
+func embedded_name(filename string) (string, bool) {
+	if !strings.HasPrefix(filename, TR_LIB_EMBEDDED + "/") { return "", false; }
+	return filename[len(TR_LIB_EMBEDDED) + 1:], true;
+}
+
+func read_file(filename string) ([]byte, error) {
+	if name, ok := embedded_name(filename); ok { return lib.Files.ReadFile(name); }
+	return os.ReadFile(filename);
+}
+
+func file_exists(filename string) bool {
+	if name, ok := embedded_name(filename); ok {
+		_, err := lib.Files.ReadFile(name);
+		return err == nil;
+	}
+	stats, err := os.Stat(filename);
+	return err == nil && stats.Mode().IsRegular();
+}
+
+func absolute_path(filename string) string {
+	if path.IsAbs(filename) || strings.HasPrefix(filename, TR_LIB_EMBEDDED + "/") { return path.Clean(filename); }
+	cwd, _ := os.Getwd();
+	return path.Join(cwd, filename);
+}
+
+// Returns the absolute path of name, looked up in dir if not absolute, or "" if there's no such file.
+// With infer, name.rb is tried before name.
+func resolve_in(dir, name string, infer bool) string {
+	candidates := []string{ name };
+	if infer && !strings.HasSuffix(name, ".rb") { candidates = []string{ name + ".rb", name }; }
+	for _, candidate := range candidates {
+		if !path.IsAbs(candidate) { candidate = path.Join(dir, candidate); }
+		if file_exists(candidate) { return absolute_path(candidate); }
+	}
+	return "";
+}
+
+// Finds the file a require of name refers to: absolute and ./ or ../ relative names are taken as they
+// are, others are looked up in each directory of $LOAD_PATH in order.
+func (vm *RubyVM) resolve_feature(name string, infer bool) string {
+	if path.IsAbs(name) || strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		return resolve_in(".", name, infer);
+	}
+	load_path := vm.globals[TrSymbol_new(vm, "$LOAD_PATH")];
+	if !TR_IMMEDIATE(load_path) && load_path.(Array) {
+		for _, dir := range Array *(load_path).values.Iter() {
+			if TR_IMMEDIATE(dir) || !dir.(String) { continue; }
+			if found := resolve_in(dir.ptr, name, infer); found != "" { return found; }
 		}
 	}
+	return "";
+}
+
+func (vm *RubyVM) load_error(name string) RubyObject {
 	vm.throw_reason = TR_THROW_EXCEPTION;
-	vm.throw_value = TrException_new(vm, vm.cSystemCallError, tr_sprintf(vm, "%s: %s", strerror(errno), filename);
+	vm.throw_value = TrException_new(vm, vm.cLoadError, tr_sprintf(vm, "cannot load such file -- %s", name));
 	return TR_UNDEF;
 }
 
+// Loads the file at the absolute path filename unless it's already in $LOADED_FEATURES. Returns true
+// if the file was loaded, false if it already was. The feature is recorded before the file runs so
+// circular requires stop, and forgotten if it raises so it can be required again.
+func (vm *RubyVM) require(filename string) RubyObject {
+	features := Array *(vm.globals[TrSymbol_new(vm, "$LOADED_FEATURES")]);
+	for _, feature := range features.values.Iter() {
+		if !TR_IMMEDIATE(feature) && feature.(String) && feature.ptr == filename { return TR_FALSE; }
+	}
+	features.Push(TrString_new2(vm, filename));
+	if vm.load(filename) == TR_UNDEF {
+		// files it required come after it, so it's not always the last one
+		for n := features.values.Len() - 1; n >= 0; n-- {
+			feature := features.values.At(n);
+			if !TR_IMMEDIATE(feature) && feature.(String) && feature.ptr == filename {
+				features.values.Delete(n);
+				break;
+			}
+		}
+		return TR_UNDEF;
+	}
+	return TR_TRUE;
+}
+
+// The directory the VM looks for boot.rb and the rest of the core library in: the copy of lib/ embedded
+// in the binary, or the directory in TINYRB_LIB when working on the core library itself.
+func tr_lib_dir() string {
+	if dir := os.Getenv("TINYRB_LIB"); dir != "" { return absolute_path(dir); }
+	return TR_LIB_EMBEDDED;
+}
+
 func (vm *RubyVM) run(block *Block, self, class *RubyObject, args []RubyObject) RubyObject {
+	frame := vm.newFrame(self, class, nil);
+	frame.cbase = class;
+	return vm.run_frame(frame, block, args);
+}
+
+// Runs block in frame, which is pushed for the time of it, args being the values of the first locals.
+func (vm *RubyVM) run_frame(frame *Frame, block *Block, args []RubyObject) RubyObject {
 	// push a frame
 	vm.cf++;
 	if vm.cf >= TR_MAX_FRAMES {
 		vm.throw_reason = TR_THROW_EXCEPTION;
 		vm.throw_value = TrException_new(vm, vm.cSystemStackError, tr_sprintf(vm, "Stack overflow");
+		vm.cf--;
 		return TR_UNDEF;
 	}
 
-	frame := newFrame(self, class, nil);
 	if vm.cf == 0 { vm.top_frame = frame; }
 	vm.frame = frame;
 	vm.throw_reason = vm.throw_value = 0;
@@ -639,11 +1022,23 @@ func (vm *RubyVM) run(block *Block, self, class *RubyObject, args []RubyObject)
 }
 
 func newRubyVM() *RubyVM {
+	vm := alloc_vm();
+	if vm.boot() == TR_UNDEF && vm.throw_reason == TR_THROW_EXCEPTION {
+		TrException_default_handler(vm, vm.throw_value));
+		abort();
+	}
+	return vm;
+}
+
+// Returns a VM with the core classes but without the part of the core library written in Ruby,
+// see boot.
+func alloc_vm() *RubyVM {
 	vm := new(RubyVM);
 	vm.symbols = make(map[string] string);
 	vm.globals = make(map[string] RubyObject);
 	vm.consts = make(map[string] RubyObject);
 	vm.debug = 0;
+	vm.out = os.Stdout;
   
 	// bootstrap core classes, order is important here, so careful, mkay?
 	TrMethod_init(vm);
@@ -657,8 +1052,12 @@ func newRubyVM() *RubyVM {
 	Class *methodc = (Class*)vm.classes[TR_T_Method];
 	Class *objectc = (Class*)vm.classes[TR_T_Object];
  	// set proper superclass has Object is defined last
-	symbolc.super = modulec.super = methodc.super = RubyObject(objectc);
-	classc.super = RubyObject(modulec);
+	symbolc.inherit(vm, objectc);
+	modulec.inherit(vm, objectc);
+	methodc.inherit(vm, objectc);
+	classc.inherit(vm, modulec);
+	// top level constants are Object's
+	objectc.consts = vm.consts;
 	// inject core classes metaclass
 	symbolc.class = newMetaClass(vm, objectc.class);
 	modulec.class = newMetaClass(vm, objectc.class);
@@ -677,10 +1076,13 @@ func newRubyVM() *RubyVM {
 	TrKernel_init(vm);
 	TrString_init(vm);
 	TrFixnum_init(vm);
+	TrBignum_init(vm);
+	TrFloat_init(vm);
 	TrArray_init(vm);
 	TrHash_init(vm);
 	TrRange_init(vm);
 	TrRegexp_init(vm);
+	TrProc_init(vm);
   
 	vm.self = Object_alloc(vm, 0);
 	vm.cf = -1;
@@ -689,12 +1091,25 @@ func newRubyVM() *RubyVM {
 	vm.sADD = TrSymbol_new(vm, "+");
 	vm.sSUB = TrSymbol_new(vm, "-");
 	vm.sLT = TrSymbol_new(vm, "<");
+	vm.sMUL = TrSymbol_new(vm, "*");
+	vm.sDIV = TrSymbol_new(vm, "/");
+	vm.sMOD = TrSymbol_new(vm, "%");
+	vm.sEQ = TrSymbol_new(vm, "==");
+	vm.sLE = TrSymbol_new(vm, "<=");
+	vm.sGT = TrSymbol_new(vm, ">");
+	vm.sGE = TrSymbol_new(vm, ">=");
 	vm.sNEG = TrSymbol_new(vm, "@-");
 	vm.sNOT = TrSymbol_new(vm, "!");
+	vm.sCOERCE = TrSymbol_new(vm, "coerce");
   
-	if vm.load("lb/boot.rb") == TR_UNDEF && vm.throw_reason == TR_THROW_EXCEPTION {
-		TrException_default_handler(vm, vm.throw_value));
-        abort();
-	}
+	// $: and $" are the short names of the same arrays
+	lib := tr_lib_dir();
+	vm.globals[TrSymbol_new(vm, "$LOAD_PATH")] = vm.globals[TrSymbol_new(vm, "$:")] = vm.newArray2(1, TrString_new2(vm, lib));
+	vm.globals[TrSymbol_new(vm, "$LOADED_FEATURES")] = vm.globals[TrSymbol_new(vm, "$\"")] = vm.newArray();
 	return vm;
+}
+
+// Loads the core library of lib/. Returns TR_UNDEF on error.
+func (vm *RubyVM) boot() RubyObject {
+	return vm.require(path.Join(tr_lib_dir(), "boot.rb"));
 }
\ No newline at end of file
@@ -0,0 +1,35 @@
+package RubyVM
+
+import (
+	"testing";
+)
+
+// Runs src and returns the calls it made whose method was in the inline cache of their site.
+func cache_hits(t *testing.T, vm *RubyVM, src string) uint64 {
+	hits := vm.cache_hits;
+	eval(t, vm, src);
+	return vm.cache_hits - hits;
+}
+
+func TestInlineCacheExpiresPerClass(t *testing.T) {
+	vm := newTestVM(t);
+	eval(t, vm, "class Dog\n  def speak\n    1\n  end\nend\nclass Puppy < Dog\nend\nclass Cat\nend\n" +
+		"def talk(a)\n  a.speak\nend\n$dog = Dog.new\n$puppy = Puppy.new\ntalk($dog)\ntalk($puppy)\n");
+	if hits := cache_hits(t, vm, "talk($dog)\ntalk($puppy)\n"); hits < 2 { t.Fatalf("expected cache hits, got %d", hits); }
+
+	// a method of another class leaves the site cached
+	eval(t, vm, "class Cat\n  def purr\n  end\nend\n");
+	if hits := cache_hits(t, vm, "talk($dog)\n"); hits < 1 { t.Errorf("a method of Cat shouldn't expire the cache of Dog"); }
+
+	// a method of a superclass expires its subclasses
+	eval(t, vm, "class Dog\n  def speak\n    2\n  end\nend\n");
+	if v := eval(t, vm, "talk($puppy)"); v.Interface() != 2 { t.Errorf("Puppy should get the new Dog#speak, got %v", v); }
+}
+
+func TestMegamorphicCacheRecovers(t *testing.T) {
+	vm := newTestVM(t);
+	eval(t, vm, "def size_of(x)\n  x.to_s\nend\n[1, 'a', :b, 1.5, [], nil].each { |x| size_of(x) }\n");
+	// once the site only sees Fixnums it caches them again after TR_MAX_MISS misses
+	eval(t, vm, "n = 0\nwhile n < 300\n  size_of(n)\n  n += 1\nend\n");
+	if hits := cache_hits(t, vm, "size_of(1)\nsize_of(2)\n"); hits < 2 { t.Errorf("the megamorphic site should cache Fixnum again, got %d hits", hits); }
+}